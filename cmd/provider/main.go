@@ -1,64 +1,425 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/autonomous-bits/nomos-provider-file/internal/provider"
 	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 const (
-	version      = "0.3.6"
-	providerType = "file"
+	version             = "0.3.6"
+	defaultProviderType = "file"
 )
 
+// providerTypeEnvVar, when set, replaces defaultProviderType as the type the
+// service reports from Info, for deployments that register this binary under
+// another logical type (e.g. "config-file").
+const providerTypeEnvVar = "NOMOS_PROVIDER_TYPE"
+
+// newService creates the provider service with the configured type.
+func newService() *provider.FileProviderService {
+	providerType := defaultProviderType
+	if value := os.Getenv(providerTypeEnvVar); value != "" {
+		providerType = value
+	}
+	return provider.NewFileProviderService(version, providerType)
+}
+
+// metricsAddrEnvVar, when set, is the address on which /metrics is served in
+// the Prometheus text format (e.g. "127.0.0.1:9464").
+const metricsAddrEnvVar = "NOMOS_PROVIDER_METRICS_ADDR"
+
+// readyLineEnvVar, when set, is a line (e.g. "PROVIDER_READY=1") printed to
+// stdout once the server accepts connections. It always follows the
+// PROVIDER_PORT line, so existing parsers that read only the first line are
+// unaffected.
+const readyLineEnvVar = "NOMOS_PROVIDER_READY_LINE"
+
+// selfTestEnvVar, when "1", makes the provider run a pre-flight check of the
+// directory named by selfTestDirEnvVar and exit instead of serving.
+const (
+	selfTestEnvVar    = "NOMOS_PROVIDER_SELFTEST"
+	selfTestDirEnvVar = "NOMOS_PROVIDER_SELFTEST_DIR"
+)
+
+// maxMsgBytesEnvVar, when set, overrides the gRPC message size limit in
+// bytes, applied to both received and sent messages.
+const maxMsgBytesEnvVar = "NOMOS_PROVIDER_MAX_MSG_BYTES"
+
+// defaultMaxMsgBytes raises gRPC's 4 MiB default so that whole-directory and
+// large-file fetches fit in one response. Larger limits let a single fetch
+// hold more memory while it is encoded.
+const defaultMaxMsgBytes = 64 << 20
+
+// maxMsgBytes returns the configured gRPC message size limit.
+func maxMsgBytes() (int, error) {
+	value := os.Getenv(maxMsgBytesEnvVar)
+	if value == "" {
+		return defaultMaxMsgBytes, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of bytes, got %q", maxMsgBytesEnvVar, value)
+	}
+	return n, nil
+}
+
+// checkWorkDir verifies that NOMOS_PROVIDER_WORKDIR, when set, names an
+// existing directory, so a typo fails at startup rather than at Init.
+func checkWorkDir() error {
+	dir := os.Getenv(provider.WorkDirEnvVar)
+	if dir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider.WorkDirEnvVar, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s must name a directory, got %q", provider.WorkDirEnvVar, dir)
+	}
+	return nil
+}
+
+// listenAddr is the address the gRPC server binds; port 0 picks a free port.
+var listenAddr = "127.0.0.1:0"
+
+// listenAddrEnvVar, when set, replaces listenAddr (e.g. "0.0.0.0:9000" to
+// bind a fixed port in a container).
+const listenAddrEnvVar = "NOMOS_PROVIDER_LISTEN_ADDR"
+
+// bindRetriesEnvVar and bindBackoffEnvVar configure retrying a fixed-port
+// bind that fails, e.g. while the previous instance releases the port during
+// a rolling restart. The backoff doubles after each attempt. A random port
+// (":0") is never retried.
+const (
+	bindRetriesEnvVar = "NOMOS_PROVIDER_BIND_RETRIES"
+	bindBackoffEnvVar = "NOMOS_PROVIDER_BIND_BACKOFF"
+)
+
+// defaultBindBackoff is the delay before the first bind retry.
+const defaultBindBackoff = 100 * time.Millisecond
+
+// bindRetry returns the configured number of bind retries and initial
+// backoff.
+func bindRetry() (int, time.Duration, error) {
+	retries, backoff := 0, defaultBindBackoff
+
+	if value := os.Getenv(bindRetriesEnvVar); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%s must be a non-negative integer, got %q", bindRetriesEnvVar, value)
+		}
+		retries = n
+	}
+
+	if value := os.Getenv(bindBackoffEnvVar); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("%s must be a positive duration, got %q", bindBackoffEnvVar, value)
+		}
+		backoff = d
+	}
+
+	return retries, backoff, nil
+}
+
+// listen binds addr, retrying a fixed port that is in use up to retries
+// times with exponential backoff. Other failures, such as a malformed
+// address or a privileged port, are returned at once.
+func listen(addr string, retries int, backoff time.Duration) (net.Listener, error) {
+	if _, port, err := net.SplitHostPort(addr); err == nil && port == "0" {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		lis, err := net.Listen("tcp", addr)
+		if err == nil || attempt >= retries || !errors.Is(err, syscall.EADDRINUSE) {
+			return lis, err
+		}
+
+		log.Printf("Bind %s failed (attempt %d of %d), retrying in %s: %v", addr, attempt+1, retries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// startupError reports a failure that happens before the PROVIDER_PORT line
+// as a single PROVIDER_ERROR line on stdout, so the orchestrator can surface
+// the reason instead of only seeing the process exit.
+func startupError(stdout io.Writer, err error) error {
+	msg := strings.ReplaceAll(err.Error(), "\n", " ")
+	fmt.Fprintf(stdout, "PROVIDER_ERROR=%s\n", msg)
+	return err
+}
+
 func main() {
-	if err := run(); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "dump" {
+		if err := runDump(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Dump failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		if err := runValidate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Validate failed: %v", err)
+		}
+		return
+	}
+
+	if os.Getenv(selfTestEnvVar) == "1" {
+		if err := runSelfTest(os.Getenv(selfTestDirEnvVar), os.Stdout); err != nil {
+			log.Fatalf("Self-test failed: %v", err)
+		}
+		return
+	}
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	if err := run(os.Stdout, sigChan); err != nil {
 		log.Fatalf("Provider failed: %v", err)
 	}
 }
 
-func run() error {
-	// Create listener on random port
-	lis, err := net.Listen("tcp", "127.0.0.1:0")
+// runDump runs Init and Fetch in-process and writes the result as JSON.
+//
+// Usage: provider dump --dir DIR FILE [KEY.PATH ...]
+//
+// Each KEY.PATH argument is split on "." and appended to the fetch path, so
+// "provider dump --dir ./configs config app.name" fetches
+// ["config", "app", "name"].
+func runDump(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "directory containing .csl files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: provider dump --dir DIR FILE [KEY.PATH ...]")
+	}
+
+	path := []string{fs.Arg(0)}
+	for _, arg := range fs.Args()[1:] {
+		path = append(path, strings.Split(arg, ".")...)
+	}
+
+	config, err := structpb.NewStruct(map[string]any{"directory": *dir})
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	ctx := context.Background()
+	svc := newService()
+	if _, err := svc.Init(ctx, &providerv1.InitRequest{Alias: "dump", Config: config}); err != nil {
+		return err
+	}
+
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: path})
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(resp.Value.AsMap(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	_, err = fmt.Fprintf(stdout, "%s\n", out)
+	return err
+}
+
+// runValidate checks an Init config read from a JSON file without touching
+// the configured directories, for CI.
+//
+// Usage: provider validate CONFIG.json
+//
+// It prints "CONFIG_OK" when Init would accept the config and fails with the
+// first problem otherwise.
+func runValidate(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: provider validate CONFIG.json")
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return fmt.Errorf("%s is not a JSON object: %w", args[0], err)
+	}
+
+	if err := provider.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, "CONFIG_OK")
+	return err
+}
+
+// runSelfTest initializes the provider against dir and parses every file,
+// without starting the server, so CI and container health checks can
+// validate a config directory. It prints a summary line on success.
+func runSelfTest(dir string, stdout io.Writer) error {
+	if dir == "" {
+		return fmt.Errorf("%s must name the directory to check", selfTestDirEnvVar)
+	}
+
+	config, err := structpb.NewStruct(map[string]any{"directory": dir})
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	ctx := context.Background()
+	svc := newService()
+	if _, err := svc.Init(ctx, &providerv1.InitRequest{Alias: "selftest", Config: config}); err != nil {
+		return err
+	}
+
+	// Fetching every file parses each of them
+	if _, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"*"}}); err != nil {
+		return err
+	}
+
+	manifest, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"__manifest__"}})
+	if err != nil {
+		return err
+	}
+	files, _ := manifest.Value.AsMap()["files"].([]any)
+
+	_, err = fmt.Fprintf(stdout, "SELFTEST_OK files=%d\n", len(files))
+	return err
+}
+
+func run(stdout io.Writer, stop <-chan os.Signal) error {
+	msgBytes, err := maxMsgBytes()
+	if err != nil {
+		return startupError(stdout, err)
+	}
+	if err := checkWorkDir(); err != nil {
+		return startupError(stdout, err)
+	}
+
+	retries, backoff, err := bindRetry()
 	if err != nil {
-		return fmt.Errorf("failed to create listener: %w", err)
+		return startupError(stdout, err)
+	}
+
+	addr := listenAddr
+	if value := os.Getenv(listenAddrEnvVar); value != "" {
+		addr = value
+	}
+
+	// Create listener, on a random port unless one is configured
+	lis, err := listen(addr, retries, backoff)
+	if err != nil {
+		return startupError(stdout, fmt.Errorf("failed to create listener: %w", err))
 	}
 
 	port := lis.Addr().(*net.TCPAddr).Port
 
 	// Print port to stdout (compiler expects this format)
-	fmt.Printf("PROVIDER_PORT=%d\n", port)
+	fmt.Fprintf(stdout, "PROVIDER_PORT=%d\n", port)
 
 	// Create gRPC server
-	server := grpc.NewServer()
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(msgBytes),
+		grpc.MaxSendMsgSize(msgBytes),
+	)
 
 	// Create and register provider service
-	svc := provider.NewFileProviderService(version, providerType)
+	svc := newService()
 	providerv1.RegisterProviderServiceServer(server, svc)
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Optionally expose metrics over HTTP
+	if addr := os.Getenv(metricsAddrEnvVar); addr != "" {
+		if err := serveMetrics(addr, svc); err != nil {
+			return err
+		}
+	}
 
-	go func() {
-		<-sigChan
-		log.Println("Received shutdown signal, stopping server...")
-		server.GracefulStop()
-	}()
+	// Reload the directory on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go reloadOnSignal(hup, svc)
 
 	// Start serving
 	log.Printf("File provider v%s listening on %s", version, lis.Addr())
 
-	if err := server.Serve(lis); err != nil {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(lis)
+	}()
+
+	// The listener is bound and the service registered, so connections made
+	// from here on are accepted; announce readiness if requested.
+	if readyLine := os.Getenv(readyLineEnvVar); readyLine != "" {
+		fmt.Fprintln(stdout, readyLine)
+	}
+
+	select {
+	case <-stop:
+		log.Println("Received shutdown signal, stopping server...")
+		server.GracefulStop()
+		return <-serveErr
+	case err := <-serveErr:
 		return fmt.Errorf("server failed: %w", err)
 	}
+}
+
+// reloadOnSignal calls svc.Reload for every signal received on sig.
+func reloadOnSignal(sig <-chan os.Signal, svc *provider.FileProviderService) {
+	for range sig {
+		if err := svc.Reload(context.Background()); err != nil {
+			log.Printf("Reload failed: %v", err)
+		}
+	}
+}
+
+// serveMetrics starts an HTTP server exposing svc's metrics at /metrics.
+func serveMetrics(addr string, svc *provider.FileProviderService) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := svc.WriteMetrics(w); err != nil {
+			log.Printf("failed to write metrics: %v", err)
+		}
+	})
+
+	log.Printf("Serving metrics on http://%s/metrics", lis.Addr())
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
 
 	return nil
 }
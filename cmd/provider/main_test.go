@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autonomous-bits/nomos-provider-file/internal/provider"
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRunDump(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "app:\n  name: myapp\n  version: 1.0.0\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runDump([]string{"--dir", tmpDir, "config", "app.name"}, &stdout); err != nil {
+		t.Fatalf("runDump failed: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", stdout.String(), err)
+	}
+	if got["value"] != "myapp" {
+		t.Errorf("Expected value 'myapp', got %v", got["value"])
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	valid := filepath.Join(tmpDir, "valid.json")
+	invalid := filepath.Join(tmpDir, "invalid.json")
+	if err := os.WriteFile(valid, []byte(`{"directory": "./configs", "recursive": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte(`{"directory": "./configs", "recursive": "yes"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runValidate([]string{valid}, &stdout); err != nil {
+		t.Fatalf("runValidate failed: %v", err)
+	}
+	if stdout.String() != "CONFIG_OK\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "CONFIG_OK\n")
+	}
+
+	stdout.Reset()
+	if err := runValidate([]string{invalid}, &stdout); err == nil || !strings.Contains(err.Error(), "recursive must be a boolean") {
+		t.Errorf("Expected the invalid option to be reported, got %v", err)
+	}
+}
+
+func TestRunDump_MissingFile(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runDump([]string{"--dir", t.TempDir()}, &stdout); err == nil {
+		t.Fatal("Expected usage error when no file is given")
+	}
+}
+
+func TestRun_PrintsReadyLineAfterPort(t *testing.T) {
+	t.Setenv(readyLineEnvVar, "PROVIDER_READY=1")
+
+	pr, pw := io.Pipe()
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(pw, stop)
+		pw.Close()
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	var lines []string
+	for len(lines) < 2 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	stop <- os.Interrupt
+	go io.Copy(io.Discard, pr)
+	if err := <-done; err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected two stdout lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "PROVIDER_PORT=") {
+		t.Errorf("Expected PROVIDER_PORT first, got %q", lines[0])
+	}
+	if lines[1] != "PROVIDER_READY=1" {
+		t.Errorf("Expected PROVIDER_READY=1 second, got %q", lines[1])
+	}
+}
+
+func TestRun_PrintsErrorLineOnBindFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	defer func(addr string) { listenAddr = addr }(listenAddr)
+	listenAddr = taken.Addr().String()
+
+	var stdout bytes.Buffer
+	if err := run(&stdout, make(chan os.Signal)); err == nil {
+		t.Fatal("Expected run to fail when the address is in use")
+	}
+
+	out := stdout.String()
+	if !strings.HasPrefix(out, "PROVIDER_ERROR=failed to create listener: ") {
+		t.Errorf("Expected a PROVIDER_ERROR line, got %q", out)
+	}
+	if strings.Contains(out, "PROVIDER_PORT=") {
+		t.Errorf("Expected no PROVIDER_PORT line, got %q", out)
+	}
+}
+
+func TestRun_FetchesPayloadLargerThanDefaultGRPCLimit(t *testing.T) {
+	t.Setenv(maxMsgBytesEnvVar, strconv.Itoa(16<<20))
+
+	tmpDir := t.TempDir()
+	blob := strings.Repeat("x", 5<<20)
+	if err := os.WriteFile(filepath.Join(tmpDir, "big.csl"), []byte("data:\n  blob: \""+blob+"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(pw, stop)
+		pw.Close()
+	}()
+	defer func() {
+		stop <- os.Interrupt
+		<-done
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	if !scanner.Scan() {
+		t.Fatal("Expected a PROVIDER_PORT line")
+	}
+	port := strings.TrimPrefix(scanner.Text(), "PROVIDER_PORT=")
+	go io.Copy(io.Discard, pr)
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(16<<20)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := providerv1.NewProviderServiceClient(conn)
+	ctx := context.Background()
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir})
+	if _, err := client.Init(ctx, &providerv1.InitRequest{Alias: "big", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	resp, err := client.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"big", "data"}})
+	if err != nil {
+		t.Fatalf("Fetch of a payload over 4MB failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["blob"]; got != blob {
+		t.Errorf("Expected the %d-byte blob, got %d bytes", len(blob), len(got.(string)))
+	}
+}
+
+func TestRun_InvalidMaxMsgBytes(t *testing.T) {
+	t.Setenv(maxMsgBytesEnvVar, "lots")
+
+	var stdout bytes.Buffer
+	if err := run(&stdout, make(chan os.Signal)); err == nil {
+		t.Fatal("Expected run to fail with an invalid message size")
+	}
+	if !strings.HasPrefix(stdout.String(), "PROVIDER_ERROR="+maxMsgBytesEnvVar) {
+		t.Errorf("Expected a PROVIDER_ERROR line, got %q", stdout.String())
+	}
+}
+
+func TestRunSelfTest(t *testing.T) {
+	good := t.TempDir()
+	if err := os.WriteFile(filepath.Join(good, "config.csl"), []byte("app:\n  name: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "config.csl"), []byte("app:\n  name: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(bad, "broken.csl"), []byte("app:\n  name: x\n---\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{name: "good directory", dir: good},
+		{name: "unparseable file", dir: bad, wantErr: true},
+		{name: "missing directory", dir: filepath.Join(good, "missing"), wantErr: true},
+		{name: "no directory", dir: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runSelfTest(tt.dir, &stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runSelfTest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && stdout.String() != "SELFTEST_OK files=1\n" {
+				t.Errorf("stdout = %q, want %q", stdout.String(), "SELFTEST_OK files=1\n")
+			}
+		})
+	}
+}
+
+func TestRunDump_WorkDirOverride(t *testing.T) {
+	workDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(workDir, "configs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "configs", "config.csl"), []byte("app:\n  name: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	t.Setenv(provider.WorkDirEnvVar, workDir)
+
+	// "configs" does not exist in the test's working directory
+	var stdout bytes.Buffer
+	if err := runDump([]string{"--dir", "configs", "config", "app.name"}, &stdout); err != nil {
+		t.Fatalf("runDump failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), `"value": "test"`) {
+		t.Errorf("Expected the value resolved under the work dir, got %s", stdout.String())
+	}
+}
+
+func TestRun_InvalidWorkDir(t *testing.T) {
+	t.Setenv(provider.WorkDirEnvVar, filepath.Join(t.TempDir(), "missing"))
+
+	var stdout bytes.Buffer
+	if err := run(&stdout, make(chan os.Signal)); err == nil {
+		t.Fatal("Expected run to fail with a missing work dir")
+	}
+	if !strings.HasPrefix(stdout.String(), "PROVIDER_ERROR="+provider.WorkDirEnvVar) {
+		t.Errorf("Expected a PROVIDER_ERROR line, got %q", stdout.String())
+	}
+}
+
+func TestListen_RetriesTemporarilyOccupiedPort(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := taken.Addr().String()
+
+	// Release the port while listen is backing off
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		taken.Close()
+		close(released)
+	}()
+
+	lis, err := listen(addr, 10, 10*time.Millisecond)
+	<-released
+	if err != nil {
+		t.Fatalf("listen failed after retries: %v", err)
+	}
+	defer lis.Close()
+
+	if lis.Addr().String() != addr {
+		t.Errorf("Expected to bind %s, got %s", addr, lis.Addr())
+	}
+}
+
+func TestListen_GivesUpAfterRetries(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	start := time.Now()
+	if _, err := listen(taken.Addr().String(), 2, 10*time.Millisecond); err == nil {
+		t.Fatal("Expected listen to fail while the port stays occupied")
+	}
+	// Backoff of 10ms then 20ms between the three attempts
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected listen to back off before giving up, took %s", elapsed)
+	}
+}
+
+func TestListen_DoesNotRetryPermanentErrors(t *testing.T) {
+	start := time.Now()
+	if _, err := listen("127.0.0.1:notaport", 5, 100*time.Millisecond); err == nil {
+		t.Fatal("Expected listen to fail on a malformed address")
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected listen to fail without backing off, took %s", elapsed)
+	}
+}
+
+func TestRun_InvalidBindRetries(t *testing.T) {
+	t.Setenv(bindRetriesEnvVar, "-1")
+
+	var stdout bytes.Buffer
+	if err := run(&stdout, make(chan os.Signal)); err == nil {
+		t.Fatal("Expected run to fail with invalid bind retries")
+	}
+	if !strings.HasPrefix(stdout.String(), "PROVIDER_ERROR="+bindRetriesEnvVar) {
+		t.Errorf("Expected a PROVIDER_ERROR line, got %q", stdout.String())
+	}
+}
+
+func TestNewService_ProviderTypeOverride(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: "file"},
+		{env: "config-file", want: "config-file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Setenv(providerTypeEnvVar, tt.env)
+
+			resp, err := newService().Info(context.Background(), &providerv1.InfoRequest{})
+			if err != nil {
+				t.Fatalf("Info failed: %v", err)
+			}
+			if resp.Type != tt.want {
+				t.Errorf("Info type = %q, want %q", resp.Type, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ go 1.26.0
 require (
 	github.com/autonomous-bits/nomos/libs/parser v0.10.0
 	github.com/autonomous-bits/nomos/libs/provider-proto v0.2.2
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b
 	google.golang.org/grpc v1.76.0
 	google.golang.org/protobuf v1.36.10
 )
@@ -14,5 +15,4 @@ require (
 	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 	golang.org/x/text v0.27.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b // indirect
 )
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Aggregates.
+//
+// A consumer that needs a summary of a numeric list rather than the list
+// itself sends the "aggregate" gRPC metadata header naming one of sum, count,
+// min or max. The fetched value must be a list whose elements are all
+// numeric (scalars are strings in converted data, so "8" and "0.5" count);
+// the result is the scalar {"value": <number>}. With a trailing "*", the
+// target's children are aggregated instead, so a map of numbers qualifies
+// (see wildcardValues).
+const aggregateHeader = "aggregate"
+
+// aggregateFuncs maps each aggregate name to its implementation. min and max
+// reject empty lists.
+var aggregateFuncs = map[string]func([]float64) (float64, error){
+	"sum": func(nums []float64) (float64, error) {
+		total := 0.0
+		for _, n := range nums {
+			total += n
+		}
+		return total, nil
+	},
+	"count": func(nums []float64) (float64, error) {
+		return float64(len(nums)), nil
+	},
+	"min": func(nums []float64) (float64, error) {
+		if len(nums) == 0 {
+			return 0, status.Error(codes.InvalidArgument, "cannot aggregate min over an empty list")
+		}
+		return slices.Min(nums), nil
+	},
+	"max": func(nums []float64) (float64, error) {
+		if len(nums) == 0 {
+			return 0, status.Error(codes.InvalidArgument, "cannot aggregate max over an empty list")
+		}
+		return slices.Max(nums), nil
+	},
+}
+
+// requestedAggregate returns the aggregate named by the request's aggregate
+// header and whether one was requested. Unknown names fail with
+// InvalidArgument.
+func requestedAggregate(ctx context.Context) (string, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false, nil
+	}
+
+	values := md.Get(aggregateHeader)
+	if len(values) == 0 {
+		return "", false, nil
+	}
+
+	name := values[0]
+	if _, known := aggregateFuncs[name]; !known {
+		return "", false, status.Errorf(codes.InvalidArgument, "%s must be one of sum, count, min or max, got %q", aggregateHeader, name)
+	}
+	return name, true, nil
+}
+
+// wildcardValues collects the children of a trailing-"*" target as a list: a
+// map's values in key-sorted order, so the result is reproducible across
+// runs, or a list's elements in source order.
+func wildcardValues(data any) any {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return data
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		values[i] = m[key]
+	}
+	return values
+}
+
+// aggregate computes the named aggregate over data, which must be a list of
+// numeric elements.
+func aggregate(name string, data any) (float64, error) {
+	list, ok := data.([]any)
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "cannot aggregate %s: target is not a list", name)
+	}
+
+	nums := make([]float64, len(list))
+	for i, element := range list {
+		n, ok := numericValue(element)
+		if !ok {
+			return 0, status.Errorf(codes.InvalidArgument, "cannot aggregate %s: element %d is not numeric: %v", name, i, element)
+		}
+		nums[i] = n
+	}
+
+	return aggregateFuncs[name](nums)
+}
+
+// numericValue reports the finite number held by a converted scalar.
+func numericValue(v any) (float64, bool) {
+	var n float64
+	switch val := v.(type) {
+	case string:
+		parsed, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, false
+		}
+		n = parsed
+	case float64:
+		n = val
+	case int:
+		n = float64(val)
+	default:
+		return 0, false
+	}
+	return n, !math.IsInf(n, 0) && !math.IsNaN(n)
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Blob files are companion files (e.g. "cert.pem") enumerated because their
+// extension is listed in blob_extensions. They bypass the parser and are
+// served as {"__blob__": true, "base64": "..."}.
+const (
+	blobKey = "__blob__"
+
+	// defaultMaxBlobBytes is used when max_blob_bytes is not configured.
+	defaultMaxBlobBytes = 1 << 20
+)
+
+// isCSLFile reports whether filePath is a .csl file rather than a blob.
+func isCSLFile(filePath string) bool {
+	return strings.HasSuffix(filePath, cslExtension)
+}
+
+// checkBlobSize fails with errLimitExceeded when filePath is a blob of more
+// than max_blob_bytes, so an oversized blob is rejected from its stat size
+// before being read into memory.
+func (c *providerConfig) checkBlobSize(filePath string, size int64) error {
+	if isCSLFile(filePath) || size <= int64(c.maxBlobBytes) {
+		return nil
+	}
+	return fmt.Errorf("%w: blob is %d bytes, more than max_blob_bytes (%d)", errLimitExceeded, size, c.maxBlobBytes)
+}
+
+// decodeFile converts the content of an enumerated file to data: .csl files
+// are parsed, blob files are wrapped as base64.
+func (c *providerConfig) decodeFile(content []byte, filePath string) (any, error) {
+	if isCSLFile(filePath) {
+		return c.converter.parseCSL(content, filePath)
+	}
+
+	// Checked before reading too (see checkBlobSize); a file that grew since
+	// is caught here
+	if err := c.checkBlobSize(filePath, int64(len(content))); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		blobKey:  true,
+		"base64": base64.StdEncoding.EncodeToString(content),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchBundle serializes every served file into a single JSON document, for
+// writing a deployment bundle artifact in one call.
+//
+// Path: ["__bundle__"]. The result is
+//
+//	{"bundle": "{\"file\": {...}, ...}", "files": N, "size": bytes}
+//
+// where "bundle" is the canonical JSON encoding (sorted keys, see
+// canonicalJSON) of an object mapping each file key to the data Fetch returns
+// for it, so the same tree always yields the same bytes. Files are loaded
+// through the parse cache and subject to the usual conversion and blob
+// limits; .csl files without fetch_root are left out. A bundle larger than
+// max_bundle_bytes fails with ResourceExhausted.
+func (s *FileProviderService) fetchBundle(ctx context.Context, args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s does not accept arguments", controlBundle)
+	}
+	if s.config.scan.lazy {
+		return nil, errLazyScan(controlBundle)
+	}
+
+	names := make([]string, 0, len(s.config.cslFiles))
+	for name := range s.config.cslFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make(map[string]any, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		filePath := s.config.cslFiles[name]
+		data, err := s.loadFile(filePath)
+		if err != nil {
+			return nil, parseStatus(fmt.Sprintf("failed to parse file %q", name), err)
+		}
+		data, ok := lookupPath(data, s.scopedKeys(filePath, nil))
+		if !ok {
+			continue
+		}
+		if data, err = s.config.handleNonFinite(data); err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+
+	encoded, err := canonicalJSON(files)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode bundle: %v", err)
+	}
+	if s.config.maxBundleBytes > 0 && len(encoded) > s.config.maxBundleBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "bundle is %d bytes, more than max_bundle_bytes (%d)",
+			len(encoded), s.config.maxBundleBytes)
+	}
+
+	return map[string]any{
+		"bundle": string(encoded),
+		"files":  len(files),
+		"size":   len(encoded),
+	}, nil
+}
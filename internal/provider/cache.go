@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultCacheMaxEntries is used when cache_max_entries is not configured.
+const defaultCacheMaxEntries = 128
+
+// parseCache is an LRU cache of converted file data and parse errors.
+//
+// Entries are keyed by absolute file path and validated against the file's
+// modtime and size, so a changed file is re-parsed on its next fetch. With a
+// ttl, entries also expire that long after they were stored, for filesystems
+// whose modtimes cannot be trusted; either check forces a re-parse. Cached
+// values are shared between fetches and must be treated as immutable.
+type parseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration // 0 disables expiry
+	entries    map[string]*list.Element
+	lru        *list.List // front is most recently used
+	bytes      int64
+	evictions  uint64
+}
+
+// cacheEntry is a single cached parse result.
+type cacheEntry struct {
+	filePath string
+	modTime  time.Time
+	size     int64
+	storedAt time.Time
+	data     any
+	err      error // parse or conversion error; data is nil when set
+
+	// timing is how producing data (or err) went, reported with cache hits
+	// as the original parse time and content hash.
+	timing parseTiming
+}
+
+// newParseCache creates a cache holding at most maxEntries results. A
+// non-positive maxEntries disables caching.
+func newParseCache(maxEntries int) *parseCache {
+	return &parseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the cached entry for filePath if it matches modTime and size
+// and has not expired.
+// Entries are never modified once stored, so the result may be read without
+// holding c.mu.
+func (c *parseCache) get(filePath string, modTime time.Time, size int64) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[filePath]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	expired := c.ttl > 0 && time.Since(entry.storedAt) >= c.ttl
+	if !entry.modTime.Equal(modTime) || entry.size != size || expired {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// put stores the result of parsing filePath, described by timing, evicting
+// the least recently used entries when the cache is full.
+func (c *parseCache) put(filePath string, modTime time.Time, size int64, timing parseTiming, data any, err error) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[filePath]; ok {
+		c.remove(elem)
+	}
+
+	c.entries[filePath] = c.lru.PushFront(&cacheEntry{
+		filePath: filePath,
+		modTime:  modTime,
+		size:     size,
+		storedAt: time.Now(),
+		data:     data,
+		err:      err,
+		timing:   timing,
+	})
+	c.bytes += size
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// remove drops elem from the cache. The caller must hold c.mu.
+func (c *parseCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.filePath)
+	c.bytes -= entry.size
+}
+
+// forget drops the entry for filePath, if any.
+func (c *parseCache) forget(filePath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[filePath]; ok {
+		c.remove(elem)
+	}
+}
+
+// purge drops every entry. Evictions are not counted, as nothing was pushed
+// out by capacity.
+func (c *parseCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// cacheStats is a point-in-time view of cache occupancy.
+type cacheStats struct {
+	entries   int
+	bytes     int64
+	evictions uint64
+}
+
+// stats returns the current occupancy. Estimated bytes are the on-disk sizes
+// of the cached files. With resetEvictions, the eviction count restarts from
+// zero.
+func (c *parseCache) stats(resetEvictions bool) cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := cacheStats{
+		entries:   c.lru.Len(),
+		bytes:     c.bytes,
+		evictions: c.evictions,
+	}
+	if resetEvictions {
+		c.evictions = 0
+	}
+	return stats
+}
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// coercionCandidatesKey lists, when report_coercion_candidates is enabled,
+// the keys of a file fetch whose string values read as a number or a boolean:
+//
+//	"__coercion_candidates__": ["database.port", "features.enabled"]
+//
+// Paths are dot-joined and relative to the fetched value, with list elements
+// addressed by index ("hosts.0"); a scalar result is reported as "value". The
+// fetched data itself is unchanged: the list only guides authors migrating
+// to typed values towards the strings to quote or re-type.
+const coercionCandidatesKey = "__coercion_candidates__"
+
+// coercionCandidates returns the sorted paths within v whose strings are
+// candidates for typing (see scalarType).
+func coercionCandidates(v any) []string {
+	var paths []string
+	var walk func(v any, path []string)
+	walk = func(v any, path []string) {
+		switch val := v.(type) {
+		case map[string]any:
+			for k, child := range val {
+				walk(child, append(path[:len(path):len(path)], k))
+			}
+		case []any:
+			for i, child := range val {
+				walk(child, append(path[:len(path):len(path)], strconv.Itoa(i)))
+			}
+		case string:
+			if scalarType(val) == scalarString {
+				return
+			}
+			if len(path) == 0 {
+				path = []string{valueWrapperKey}
+			}
+			paths = append(paths, strings.Join(path, "."))
+		}
+	}
+	walk(v, nil)
+
+	sort.Strings(paths)
+	return paths
+}
+
+// setCoercionCandidates adds the "__coercion_candidates__" entry listing paths
+// to value.
+func setCoercionCandidates(value *structpb.Struct, paths []string) {
+	list := make([]*structpb.Value, len(paths))
+	for i, p := range paths {
+		list[i] = structpb.NewStringValue(p)
+	}
+	value.Fields[coercionCandidatesKey] = structpb.NewListValue(&structpb.ListValue{Values: list})
+}
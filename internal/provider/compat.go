@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Values of the "compat_version" config key. compatLatest (the default)
+// enables every output option; an older version pins the output shape that
+// release produced, so pinned consumers can migrate on their own schedule.
+const (
+	compatLatest = "latest"
+	// compatV02 reproduces the 0.2 output: every scalar, including numbers,
+	// durations and sizes, is a string, and references are
+	// "reference:alias:path" strings.
+	compatV02 = "0.2"
+)
+
+// compatPinnedKeys lists, per compat_version, the config keys whose non-default
+// values would change the pinned output shape.
+var compatPinnedKeys = map[string][]string{
+	compatV02: {"normalize_units", "ref_format", "typed_values"},
+}
+
+// parseCompatVersion reads compat_version and rejects config keys that would
+// produce output the requested version did not.
+func parseCompatVersion(configMap map[string]any) (string, error) {
+	version, err := stringOption(configMap, "compat_version", compatLatest, compatLatest, compatV02)
+	if err != nil {
+		return "", err
+	}
+
+	for _, key := range compatPinnedKeys[version] {
+		value, ok := configMap[key]
+		if !ok || value == false || value == refFormatString {
+			continue
+		}
+		return "", status.Errorf(codes.InvalidArgument,
+			"config key '%s' changes the output shape and cannot be combined with compat_version %q", key, version)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Conditional fetch.
+//
+// FetchRequest has no field for a client's cached version, so a conditional
+// fetch is requested with the "if-none-match" gRPC metadata header carrying
+// the content hash the client already holds. If the file still hashes to that
+// value, Fetch returns {"__not_modified__": true, "__hash__": hash} instead of
+// the data. Otherwise it returns the data with "__hash__" set to the current
+// hash. Sending an empty header fetches the data together with its hash.
+//
+// The hash is the hex SHA-256 of the whole file, so it changes whenever any
+// part of the file does, whichever sub-path was fetched.
+const (
+	ifNoneMatchHeader = "if-none-match"
+	hashKey           = "__hash__"
+	notModifiedKey    = "__not_modified__"
+)
+
+// ETags.
+//
+// With "etag" enabled, file fetches carry an HTTP-style entity tag derived
+// from the file's raw bytes: the first etagLength hex digits of a SHA-256 over
+// the file hash and the response's variant, in double quotes (e.g.
+// "\"3a7bd3e2360a3d29\""). It is returned both as the "__etag__" key of the
+// value and as the "etag" gRPC response header, so proxies can forward it and
+// set If-None-Match on later requests.
+//
+// The variant is the fetch path plus the headers that reshape the response
+// (see etagVariantHeaders), so different bodies of one file never share a
+// tag. An if-none-match header carrying the tag, quoted or not and with or
+// without a weak "W/" prefix, matches like the full hash.
+const (
+	etagKey    = "__etag__"
+	etagHeader = "etag"
+	etagLength = 16
+)
+
+// ifNoneMatch returns the hash from the request's if-none-match header and
+// whether the header was present.
+func ifNoneMatch(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(ifNoneMatchHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// fileHash returns the hex SHA-256 of the file's content.
+func fileHash(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// etagVariantHeaders are the request headers that change a file fetch's
+// body, in the order they are mixed into its entity tag.
+var etagVariantHeaders = []string{
+	sampleHeader,
+	skeletonHeader,
+	projectionHeader,
+	aggregateHeader,
+	listLimitHeader,
+	canonicalJSONHeader,
+}
+
+// etagVariant describes which body of a file a fetch of path returns: the
+// path itself and the reshaping headers set on the request.
+func etagVariant(ctx context.Context, path []string) string {
+	parts := []string{fmt.Sprintf("path=%q", path)}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return parts[0]
+	}
+	for _, header := range etagVariantHeaders {
+		if values := md.Get(header); len(values) > 0 {
+			parts = append(parts, header+"="+values[0])
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// formatETag renders a file hash, combined with the request's variant (see
+// etagVariant), as a quoted entity tag.
+func formatETag(hash, variant string) string {
+	if variant != "" {
+		sum := sha256.Sum256([]byte(hash + "\n" + variant))
+		hash = hex.EncodeToString(sum[:])
+	}
+	return `"` + hash[:etagLength] + `"`
+}
+
+// matchesClient reports whether the client's if-none-match value names the
+// current content: the full file hash, or the entity tag of this variant.
+func matchesClient(clientValue, hash, variant string) bool {
+	if clientValue == hash {
+		return true
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(clientValue), "W/")
+	return strings.Trim(tag, `"`) == strings.Trim(formatETag(hash, variant), `"`)
+}
+
+// setETag adds the entity tag for hash and variant to value and to the
+// response header.
+func setETag(ctx context.Context, value *structpb.Struct, hash, variant string) {
+	etag := formatETag(hash, variant)
+	value.Fields[etagKey] = structpb.NewStringValue(etag)
+
+	// SetHeader fails outside a gRPC server stream (e.g. in-process calls);
+	// the value still carries the tag.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(etagHeader, etag))
+}
+
+// notModifiedStruct is the Fetch value returned when the client's hash is
+// current.
+func notModifiedStruct(hash string) *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		notModifiedKey: structpb.NewBoolValue(true),
+		hashKey:        structpb.NewStringValue(hash),
+	}}
+}
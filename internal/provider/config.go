@@ -0,0 +1,777 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// durationOption reads an optional duration config value given as a Go
+// duration string (e.g. "500ms", "10s"). A missing key yields zero.
+func durationOption(configMap map[string]any, key string) (time.Duration, error) {
+	value, ok := configMap[key]
+	if !ok {
+		return 0, nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be a duration string, got %T", key, value)
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be a non-negative duration (e.g. \"10s\"), got %q", key, str)
+	}
+
+	return d, nil
+}
+
+// stringOption reads an optional string config value, returning def when the
+// key is missing. When allowed is non-empty the value must be one of them.
+func stringOption(configMap map[string]any, key, def string, allowed ...string) (string, error) {
+	value, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "%s must be a string, got %T", key, value)
+	}
+
+	if len(allowed) == 0 {
+		return str, nil
+	}
+	for _, a := range allowed {
+		if str == a {
+			return str, nil
+		}
+	}
+
+	return "", status.Errorf(codes.InvalidArgument, "%s must be one of %s, got %q", key, strings.Join(allowed, ", "), str)
+}
+
+// intOption reads an optional non-negative integer config value. Numbers
+// arrive from structpb as float64, so fractional values are rejected. A
+// missing key yields zero.
+func intOption(configMap map[string]any, key string) (int, error) {
+	value, ok := configMap[key]
+	if !ok {
+		return 0, nil
+	}
+
+	f, ok := value.(float64)
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be a number, got %T", key, value)
+	}
+
+	if f < 0 || f != math.Trunc(f) || f > math.MaxInt32 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be a non-negative integer, got %v", key, f)
+	}
+
+	return int(f), nil
+}
+
+// boolOption reads an optional boolean config value. A missing key yields false.
+func boolOption(configMap map[string]any, key string) (bool, error) {
+	value, ok := configMap[key]
+	if !ok {
+		return false, nil
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, status.Errorf(codes.InvalidArgument, "%s must be a boolean, got %T", key, value)
+	}
+
+	return b, nil
+}
+
+// stringListOption reads an optional list of strings. A missing key yields nil.
+func stringListOption(configMap map[string]any, key string) ([]string, error) {
+	value, ok := configMap[key]
+	if !ok {
+		return nil, nil
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%s must be a list of strings, got %T", key, value)
+	}
+
+	result := make([]string, len(list))
+	for i, item := range list {
+		str, ok := item.(string)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "%s[%d] must be a string, got %T", key, i, item)
+		}
+		result[i] = str
+	}
+
+	return result, nil
+}
+
+// globListOption reads an optional list of glob patterns, validating each.
+func globListOption(configMap map[string]any, key string) ([]string, error) {
+	patterns, err := stringListOption(configMap, key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range patterns {
+		if err := validateGlob(pattern); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: %v", key, err)
+		}
+	}
+
+	return patterns, nil
+}
+
+// parseScanOptions reads the directory scanning options.
+func parseScanOptions(configMap map[string]any) (scanOptions, error) {
+	var opts scanOptions
+	var err error
+
+	if opts.recursive, err = boolOption(configMap, "recursive"); err != nil {
+		return opts, err
+	}
+	if opts.lazy, err = boolOption(configMap, "lazy_scan"); err != nil {
+		return opts, err
+	}
+	if opts.include, err = globListOption(configMap, "include"); err != nil {
+		return opts, err
+	}
+	if opts.exclude, err = globListOption(configMap, "exclude"); err != nil {
+		return opts, err
+	}
+	if opts.blobExtensions, err = stringListOption(configMap, "blob_extensions"); err != nil {
+		return opts, err
+	}
+	for i, ext := range opts.blobExtensions {
+		if ext == "" || ext == cslExtension || ext == strings.TrimPrefix(cslExtension, ".") || strings.Contains(ext, "/") {
+			return opts, status.Errorf(codes.InvalidArgument, "blob_extensions[%d]: invalid extension %q", i, ext)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			opts.blobExtensions[i] = "." + ext
+		}
+	}
+	if opts.extensionTrim, err = stringOption(configMap, "extension_trim", extensionTrimLast, extensionTrimLast, extensionTrimAll); err != nil {
+		return opts, err
+	}
+	if opts.keepExtension, err = boolOption(configMap, "keep_extension"); err != nil {
+		return opts, err
+	}
+	if opts.keepExtension && opts.extensionTrim == extensionTrimAll {
+		return opts, status.Error(codes.InvalidArgument, "extension_trim 'all' has no effect with keep_extension, which keeps the full file name")
+	}
+	if opts.onDuplicate, err = stringOption(configMap, "on_duplicate", onDuplicateError, onDuplicateError, onDuplicateFirstWins); err != nil {
+		return opts, err
+	}
+	if opts.fileList, err = stringListOption(configMap, "file_list"); err != nil {
+		return opts, err
+	}
+	if opts.keyStyle, err = stringOption(configMap, "key_style", keyStylePath, keyStylePath, keyStyleDotted); err != nil {
+		return opts, err
+	}
+	if opts.keyStyle == keyStyleDotted && opts.lazy {
+		return opts, status.Error(codes.InvalidArgument, "key_style 'dotted' is not supported with lazy_scan, which resolves keys as paths")
+	}
+	opts.jailToRoot = true
+	if _, ok := configMap["jail_to_root"]; ok {
+		if opts.jailToRoot, err = boolOption(configMap, "jail_to_root"); err != nil {
+			return opts, err
+		}
+	}
+	if _, hasOverlay := configMap["overlay_dir"]; hasOverlay {
+		if opts.lazy {
+			return opts, status.Error(codes.InvalidArgument, "config keys 'overlay_dir' and 'lazy_scan' are mutually exclusive")
+		}
+		if len(opts.fileList) > 0 {
+			return opts, status.Error(codes.InvalidArgument, "config keys 'overlay_dir' and 'file_list' are mutually exclusive")
+		}
+	}
+	if len(opts.fileList) > 0 {
+		if opts.lazy {
+			return opts, status.Error(codes.InvalidArgument, "config keys 'file_list' and 'lazy_scan' are mutually exclusive")
+		}
+		if _, hasRoots := configMap["roots"]; hasRoots {
+			return opts, status.Error(codes.InvalidArgument, "config keys 'file_list' and 'roots' are mutually exclusive")
+		}
+	}
+
+	return opts, nil
+}
+
+// stringsToAny converts a string slice for use in structpb-compatible maps.
+func stringsToAny(values []string) []any {
+	result := make([]any, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// parseTransforms reads the "transforms" map of dotted value path to
+// transform name (e.g. {"database.password": "base64decode"}), sorted by
+// path. Unknown transform names are rejected.
+func parseTransforms(configMap map[string]any) ([]fieldTransform, error) {
+	value, ok := configMap["transforms"]
+	if !ok {
+		return nil, nil
+	}
+
+	transformsMap, ok := value.(map[string]any)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "transforms must be a map of value path to transform name, got %T", value)
+	}
+
+	transforms := make([]fieldTransform, 0, len(transformsMap))
+	for path, nameValue := range transformsMap {
+		name, ok := nameValue.(string)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "transform for %q must be a string, got %T", path, nameValue)
+		}
+		if _, known := transformFuncs[name]; !known {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown transform %q for %q; must be one of %q", name, path, transformNames())
+		}
+
+		keys := strings.Split(path, ".")
+		if slices.Contains(keys, "") {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid transform path %q", path)
+		}
+		transforms = append(transforms, fieldTransform{path: keys, name: name})
+	}
+
+	sort.Slice(transforms, func(i, j int) bool {
+		return strings.Join(transforms[i].path, ".") < strings.Join(transforms[j].path, ".")
+	})
+	return transforms, nil
+}
+
+// parseConfig parses and validates the Init options other than the location
+// keys ("directory", "roots", "base_dir" / "overlay_dir"; see parseLocation).
+// It does not touch the filesystem; the returned config still needs its alias
+// and files.
+func parseConfig(configMap map[string]any) (*providerConfig, error) {
+	initTimeout, err := durationOption(configMap, "init_timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	compatVersion, err := parseCompatVersion(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	refFormat, err := stringOption(configMap, "ref_format", refFormatString, refFormatString, refFormatStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	refAliasPrefix, err := stringOption(configMap, "ref_alias_prefix", "")
+	if err != nil {
+		return nil, err
+	}
+
+	maxDepth, err := intOption(configMap, "max_depth")
+	if err != nil {
+		return nil, err
+	}
+
+	maxNodes, err := intOption(configMap, "max_nodes")
+	if err != nil {
+		return nil, err
+	}
+
+	scan, err := parseScanOptions(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	reloadInterval, err := durationOption(configMap, "reload_interval")
+	if err != nil {
+		return nil, err
+	}
+	if reloadInterval > 0 && scan.lazy {
+		return nil, status.Error(codes.InvalidArgument, "config keys 'reload_interval' and 'lazy_scan' are mutually exclusive")
+	}
+
+	rootEntries, err := stringOption(configMap, "root_entries", rootEntriesInline, rootEntriesInline, rootEntriesNested)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCollision, err := stringOption(configMap, "root_collision", rootCollisionError, rootCollisionError, rootCollisionSectionWins, rootCollisionEntryWins)
+	if err != nil {
+		return nil, err
+	}
+
+	normalizeUnits, err := boolOption(configMap, "normalize_units")
+	if err != nil {
+		return nil, err
+	}
+
+	descendValueWrapper, err := boolOption(configMap, "descend_value_wrapper")
+	if err != nil {
+		return nil, err
+	}
+
+	stripPrivate, err := boolOption(configMap, "strip_underscore_keys")
+	if err != nil {
+		return nil, err
+	}
+	privateKeyPrefix, err := stringOption(configMap, "private_key_prefix", "_")
+	if err != nil {
+		return nil, err
+	}
+	if privateKeyPrefix == "" {
+		return nil, status.Error(codes.InvalidArgument, "private_key_prefix cannot be empty")
+	}
+	if !stripPrivate {
+		privateKeyPrefix = ""
+	}
+
+	inlineImports, err := boolOption(configMap, "inline_imports")
+	if err != nil {
+		return nil, err
+	}
+
+	typedValues, err := boolOption(configMap, "typed_values")
+	if err != nil {
+		return nil, err
+	}
+	if typedValues && normalizeUnits {
+		return nil, status.Error(codes.InvalidArgument, "config keys 'typed_values' and 'normalize_units' are mutually exclusive")
+	}
+
+	transforms, err := parseTransforms(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	allowWrite, err := boolOption(configMap, "allow_write")
+	if err != nil {
+		return nil, err
+	}
+	if _, hasOverlay := configMap["overlay_dir"]; hasOverlay && allowWrite {
+		return nil, status.Error(codes.InvalidArgument, "allow_write is not supported with overlay_dir, which serves a read-only union")
+	}
+
+	maxBlobBytes := defaultMaxBlobBytes
+	if _, ok := configMap["max_blob_bytes"]; ok {
+		maxBlobBytes, err = intOption(configMap, "max_blob_bytes")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxBundleBytes, err := intOption(configMap, "max_bundle_bytes")
+	if err != nil {
+		return nil, err
+	}
+
+	fetchRoot, err := stringListOption(configMap, "fetch_root")
+	if err != nil {
+		return nil, err
+	}
+
+	activeVariant, err := stringOption(configMap, "active_variant", "")
+	if err != nil {
+		return nil, err
+	}
+	strictVariant, err := boolOption(configMap, "strict_variant")
+	if err != nil {
+		return nil, err
+	}
+
+	defaultFile, err := stringOption(configMap, "default_file", "")
+	if err != nil {
+		return nil, err
+	}
+
+	sourceInfo, err := boolOption(configMap, "source_info")
+	if err != nil {
+		return nil, err
+	}
+
+	coercionReport, err := boolOption(configMap, "report_coercion_candidates")
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := boolOption(configMap, "etag")
+	if err != nil {
+		return nil, err
+	}
+
+	caseInsensitiveKeys, err := boolOption(configMap, "case_insensitive_keys")
+	if err != nil {
+		return nil, err
+	}
+
+	inheritParentKeys, err := boolOption(configMap, "inherit_parent_keys")
+	if err != nil {
+		return nil, err
+	}
+
+	followReferences, err := boolOption(configMap, "follow_references")
+	if err != nil {
+		return nil, err
+	}
+
+	checkSourceAlias, err := boolOption(configMap, "check_source_alias")
+	if err != nil {
+		return nil, err
+	}
+
+	nonFiniteNumbers, err := stringOption(configMap, "non_finite_numbers", nonFiniteError, nonFiniteError, nonFiniteString)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotDepth, err := intOption(configMap, "snapshot_depth")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := durationOption(configMap, "cache_ttl")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMaxEntries := defaultCacheMaxEntries
+	if _, ok := configMap["cache_max_entries"]; ok {
+		cacheMaxEntries, err = intOption(configMap, "cache_max_entries")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config := &providerConfig{
+		initTimeout:         initTimeout,
+		compatVersion:       compatVersion,
+		reloadInterval:      reloadInterval,
+		scan:                scan,
+		allowWrite:          allowWrite,
+		maxBlobBytes:        maxBlobBytes,
+		maxBundleBytes:      maxBundleBytes,
+		fetchRoot:           fetchRoot,
+		activeVariant:       activeVariant,
+		strictVariant:       strictVariant,
+		defaultFile:         defaultFile,
+		sourceInfo:          sourceInfo,
+		coercionReport:      coercionReport,
+		etag:                etag,
+		caseInsensitiveKeys: caseInsensitiveKeys,
+		inheritParentKeys:   inheritParentKeys,
+		descendValueWrapper: descendValueWrapper,
+		followReferences:    followReferences,
+		checkSourceAlias:    checkSourceAlias,
+		nonFiniteNumbers:    nonFiniteNumbers,
+		converter: converter{
+			refFormat:        refFormat,
+			refAliasPrefix:   refAliasPrefix,
+			rootEntries:      rootEntries,
+			rootCollision:    rootCollision,
+			normalizeUnits:   normalizeUnits,
+			typedValues:      typedValues,
+			inlineImports:    inlineImports,
+			privateKeyPrefix: privateKeyPrefix,
+			transforms:       transforms,
+			maxDepth:         maxDepth,
+			maxNodes:         maxNodes,
+		},
+	}
+	if cacheMaxEntries > 0 {
+		config.cache = newParseCache(cacheMaxEntries)
+		config.cache.ttl = cacheTTL
+	}
+	if snapshotDepth > 0 {
+		config.snapshots = newSnapshotStore(snapshotDepth)
+	}
+	config.converter.refTarget = config.referenceTarget
+
+	return config, nil
+}
+
+// parseLocation validates the location keys: exactly one of "directory" (a
+// string), "roots" (a non-empty map of root name to directory string), or
+// "base_dir" together with "overlay_dir" (strings). Directories are returned
+// as given, unresolved; base_dir is returned as directory. roots is nil
+// unless configured, and overlay is "" unless overlay_dir is.
+func parseLocation(configMap map[string]any) (directory, overlay string, roots map[string]string, err error) {
+	rootsValue, hasRoots := configMap["roots"]
+	dirValue, hasDirectory := configMap["directory"]
+	baseValue, hasBase := configMap["base_dir"]
+	overlayValue, hasOverlay := configMap["overlay_dir"]
+
+	switch {
+	case hasRoots && hasDirectory:
+		return "", "", nil, status.Error(codes.InvalidArgument, "config keys 'directory' and 'roots' are mutually exclusive")
+
+	case (hasBase || hasOverlay) && (hasRoots || hasDirectory):
+		return "", "", nil, status.Error(codes.InvalidArgument, "config keys 'base_dir' and 'overlay_dir' are mutually exclusive with 'directory' and 'roots'")
+
+	case hasBase != hasOverlay:
+		return "", "", nil, status.Error(codes.InvalidArgument, "config keys 'base_dir' and 'overlay_dir' must be set together")
+
+	case hasBase:
+		baseStr, ok := baseValue.(string)
+		if !ok {
+			return "", "", nil, status.Errorf(codes.InvalidArgument,
+				"base_dir must be a string path (e.g. \"./base\"), got %s; quote the value if it was meant as a path", describeConfigValue(baseValue))
+		}
+		overlayStr, ok := overlayValue.(string)
+		if !ok {
+			return "", "", nil, status.Errorf(codes.InvalidArgument,
+				"overlay_dir must be a string path (e.g. \"./overlay\"), got %s; quote the value if it was meant as a path", describeConfigValue(overlayValue))
+		}
+		// Both resolve against the same directory, so comparing them as
+		// written catches most nesting; Init checks the resolved paths too
+		if err := checkLayers(filepath.Clean(baseStr), filepath.Clean(overlayStr)); err != nil {
+			return "", "", nil, err
+		}
+		return baseStr, overlayStr, nil, nil
+
+	case hasRoots:
+		rootsMap, ok := rootsValue.(map[string]any)
+		if !ok || len(rootsMap) == 0 {
+			return "", "", nil, status.Error(codes.InvalidArgument, "roots must be a non-empty map of root name to directory")
+		}
+
+		roots = make(map[string]string, len(rootsMap))
+		for name, value := range rootsMap {
+			if name == "" || name == "*" || strings.Contains(name, "/") {
+				return "", "", nil, status.Errorf(codes.InvalidArgument, "invalid root name %q", name)
+			}
+
+			dirStr, ok := value.(string)
+			if !ok {
+				return "", "", nil, status.Errorf(codes.InvalidArgument,
+					"directory for root %q must be a string path (e.g. \"./configs\"), got %s; quote the value if it was meant as a path", name, describeConfigValue(value))
+			}
+			roots[name] = dirStr
+		}
+		return "", "", roots, nil
+
+	case hasDirectory:
+		dirStr, ok := dirValue.(string)
+		if !ok {
+			return "", "", nil, status.Errorf(codes.InvalidArgument,
+				"directory must be a string path (e.g. \"./configs\"), got %s; quote the value if it was meant as a path", describeConfigValue(dirValue))
+		}
+		return dirStr, "", nil, nil
+
+	default:
+		return "", "", nil, status.Error(codes.InvalidArgument, "missing required config key 'directory'")
+	}
+}
+
+// checkLayers rejects a base_dir and overlay_dir where one contains the
+// other: the outer layer would also enumerate the inner one's files, under
+// prefixed keys and in the wrong layer.
+func checkLayers(base, overlay string) error {
+	if containsPath(base, overlay) || containsPath(overlay, base) {
+		return status.Errorf(codes.InvalidArgument, "base_dir %q and overlay_dir %q must not be nested within each other", base, overlay)
+	}
+	return nil
+}
+
+// containsPath reports whether path is dir or lies within it, comparing the
+// paths lexically.
+func containsPath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// knownConfigKeys lists every Init config key the provider understands.
+var knownConfigKeys = []string{
+	"active_variant",
+	"allow_write",
+	"base_dir",
+	"blob_extensions",
+	"cache_max_entries",
+	"cache_ttl",
+	"case_insensitive_keys",
+	"check_source_alias",
+	"compat_version",
+	"default_file",
+	"descend_value_wrapper",
+	"directory",
+	"etag",
+	"exclude",
+	"extension_trim",
+	"fetch_root",
+	"file_list",
+	"follow_references",
+	"ignore_unknown_config",
+	"include",
+	"inherit_parent_keys",
+	"init_timeout",
+	"inline_imports",
+	"jail_to_root",
+	"keep_extension",
+	"key_style",
+	"lazy_scan",
+	"max_blob_bytes",
+	"max_bundle_bytes",
+	"max_depth",
+	"max_nodes",
+	"non_finite_numbers",
+	"normalize_units",
+	"on_duplicate",
+	"overlay_dir",
+	"private_key_prefix",
+	"recursive",
+	"ref_alias_prefix",
+	"ref_format",
+	"reload_interval",
+	"report_coercion_candidates",
+	"root_collision",
+	"root_entries",
+	"roots",
+	"snapshot_depth",
+	"source_info",
+	"strict_variant",
+	"strip_underscore_keys",
+	"transforms",
+	"typed_values",
+}
+
+// unknownConfigKeys returns the keys of configMap the provider does not
+// understand, sorted.
+func unknownConfigKeys(configMap map[string]any) []string {
+	var unknown []string
+	for key := range configMap {
+		if !slices.Contains(knownConfigKeys, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkUnknownKeys rejects config keys the provider does not understand,
+// suggesting close matches for likely typos, unless ignore_unknown_config is
+// set for forward compatibility with newer configs.
+func checkUnknownKeys(configMap map[string]any) error {
+	ignore, err := boolOption(configMap, "ignore_unknown_config")
+	if err != nil {
+		return err
+	}
+
+	unknown := unknownConfigKeys(configMap)
+	if ignore || len(unknown) == 0 {
+		return nil
+	}
+
+	described := make([]string, len(unknown))
+	for i, key := range unknown {
+		described[i] = key
+		if suggestion, ok := closestConfigKey(key); ok {
+			described[i] = fmt.Sprintf("%s (did you mean %q?)", key, suggestion)
+		}
+	}
+
+	return status.Errorf(codes.InvalidArgument,
+		"unknown config keys: %s; set ignore_unknown_config: true to ignore them", strings.Join(described, ", "))
+}
+
+// closestConfigKey returns the known key nearest to key by edit distance, if
+// it is within a third of key's length (at least one edit) and so a
+// plausible typo.
+func closestConfigKey(key string) (string, bool) {
+	best, bestDistance := "", max(len(key)/3, 1)+1
+	for _, known := range knownConfigKeys {
+		if d := editDistance(key, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting an
+// adjacent transposition as a single edit.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(b)]
+}
+
+// ValidateConfig checks an Init configuration without touching the
+// filesystem: unknown keys, value types, allowed values, and conflicting
+// options. It returns an InvalidArgument status describing the first problem
+// found, or nil if Init would accept the configuration (assuming its
+// directories exist and contain .csl files).
+//
+// Values may use any type accepted by structpb.NewStruct; numbers need not be
+// float64.
+func ValidateConfig(cfg map[string]any) error {
+	normalized, err := structpb.NewStruct(cfg)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "config is not representable as a Struct: %v", err)
+	}
+	configMap := normalized.AsMap()
+
+	if err := checkUnknownKeys(configMap); err != nil {
+		return err
+	}
+
+	if _, err := parseConfig(configMap); err != nil {
+		return err
+	}
+
+	_, _, _, err = parseLocation(configMap)
+	return err
+}
+
+// describeConfigValue names the type of a config value as it was written
+// (Struct values arrive as JSON types) along with the value itself, e.g.
+// "number 123" or "boolean true", for messages read by config authors
+// rather than Go developers.
+func describeConfigValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return "number " + strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return "boolean " + strconv.FormatBool(v)
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "a map"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T %v", v, v)
+	}
+}
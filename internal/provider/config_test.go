@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValidateConfig_Valid(t *testing.T) {
+	configs := []map[string]any{
+		{"directory": "./configs"},
+		{"directory": "/etc/nomos", "recursive": true, "include": []any{"**/*.csl"}, "max_depth": 64},
+		{"roots": map[string]any{"a": "./a", "b": "./b"}, "init_timeout": "5s"},
+	}
+
+	for _, cfg := range configs {
+		if err := ValidateConfig(cfg); err != nil {
+			t.Errorf("ValidateConfig(%v) = %v, want nil", cfg, err)
+		}
+	}
+}
+
+func TestValidateConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  map[string]any
+		want string
+	}{
+		{"missing directory", map[string]any{}, "missing required config key 'directory'"},
+		{"numeric directory", map[string]any{"directory": 123}, `directory must be a string path (e.g. "./configs"), got number 123`},
+		{"boolean directory", map[string]any{"directory": true}, `directory must be a string path (e.g. "./configs"), got boolean true`},
+		{"numeric root directory", map[string]any{"roots": map[string]any{"a": 1.5}}, `directory for root "a" must be a string path (e.g. "./configs"), got number 1.5`},
+		{"wrong type", map[string]any{"directory": "./configs", "recursive": "yes"}, "recursive must be a boolean"},
+		{"negative number", map[string]any{"directory": "./configs", "max_depth": -1}, "max_depth must be a non-negative integer"},
+		{"bad enum", map[string]any{"directory": "./configs", "ref_format": "xml"}, "ref_format must be one of"},
+		{"unknown key", map[string]any{"directroy": "./configs"}, `unknown config keys: directroy (did you mean "directory"?)`},
+		{"directory and roots", map[string]any{"directory": "./a", "roots": map[string]any{"b": "./b"}}, "mutually exclusive"},
+		{"keep_extension and extension_trim all", map[string]any{"directory": "./a", "keep_extension": true, "extension_trim": "all"}, "no effect with keep_extension"},
+		{"base_dir without overlay_dir", map[string]any{"base_dir": "./a"}, "must be set together"},
+		{"overlay_dir and directory", map[string]any{"directory": "./a", "base_dir": "./b", "overlay_dir": "./c"}, "mutually exclusive"},
+		{"overlay_dir and allow_write", map[string]any{"base_dir": "./a", "overlay_dir": "./b", "allow_write": true}, "read-only union"},
+		{"overlay_dir inside base_dir", map[string]any{"base_dir": "./a", "overlay_dir": "./a/overlay"}, "must not be nested"},
+		{"base_dir inside overlay_dir", map[string]any{"base_dir": "a/base", "overlay_dir": "./a"}, "must not be nested"},
+		{"same base_dir and overlay_dir", map[string]any{"base_dir": "./a", "overlay_dir": "a/"}, "must not be nested"},
+		{"unknown transform", map[string]any{"directory": "./a", "transforms": map[string]any{"db.password": "rot13"}}, `unknown transform "rot13"`},
+		{"typed_values and normalize_units", map[string]any{"directory": "./a", "typed_values": true, "normalize_units": true}, "mutually exclusive"},
+		{"unknown compat_version", map[string]any{"directory": "./a", "compat_version": "0.1"}, "compat_version must be one of"},
+		{"compat_version and ref_format", map[string]any{"directory": "./a", "compat_version": "0.2", "ref_format": "struct"}, "cannot be combined with compat_version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(tt.cfg)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected InvalidArgument, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestInit_UnknownConfigKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("name: test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initWith := func(configMap map[string]any) error {
+		config, err := structpb.NewStruct(configMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := NewFileProviderService("0.1.0", "file")
+		_, err = svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+		return err
+	}
+
+	err := initWith(map[string]any{"directory": tmpDir, "recursiv": true, "zzz_future_option": 1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for unknown keys, got %v", err)
+	}
+	for _, want := range []string{`recursiv (did you mean "recursive"?)`, "zzz_future_option", "ignore_unknown_config"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error containing %q, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "zzz_future_option (did you mean") {
+		t.Errorf("Expected no suggestion for an unrelated key, got %v", err)
+	}
+
+	if err := initWith(map[string]any{"directory": tmpDir, "zzz_future_option": 1, "ignore_unknown_config": true}); err != nil {
+		t.Errorf("Expected unknown keys to be ignored, got %v", err)
+	}
+}
+
+func TestInit_EnvConfigOverride(t *testing.T) {
+	configured := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configured, "configured.csl"), []byte("app:\n  name: configured\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	override := t.TempDir()
+	if err := os.WriteFile(filepath.Join(override, "override.csl"), []byte("app:\n  name: override\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NOMOS_PROVIDER_CONFIG_DIRECTORY", override)
+	t.Setenv("NOMOS_PROVIDER_CONFIG_CASE_INSENSITIVE_KEYS", "true")
+
+	tests := []struct {
+		precedence string
+		wantDir    string
+		wantFile   string
+	}{
+		{precedence: "", wantDir: override, wantFile: "override"},
+		{precedence: "env", wantDir: override, wantFile: "override"},
+		{precedence: "config", wantDir: configured, wantFile: "configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.precedence, func(t *testing.T) {
+			t.Setenv(envConfigPrecedenceVar, tt.precedence)
+
+			svc := NewFileProviderService("0.1.0", "file")
+			config, _ := structpb.NewStruct(map[string]any{"directory": configured})
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			if svc.config.directory != tt.wantDir {
+				t.Errorf("Expected directory %q, got %q", tt.wantDir, svc.config.directory)
+			}
+			if _, ok := svc.config.cslFiles[tt.wantFile]; !ok {
+				t.Errorf("Expected file %q, got %v", tt.wantFile, svc.config.cslFiles)
+			}
+			// The JSON value true is decoded as a bool
+			if !svc.config.caseInsensitiveKeys {
+				t.Error("Expected case_insensitive_keys from the environment")
+			}
+		})
+	}
+}
+
+func TestInit_EnvConfigUnknownKey(t *testing.T) {
+	t.Setenv("NOMOS_PROVIDER_CONFIG_RECURSIV", "true")
+
+	svc := NewFileProviderService("0.1.0", "file")
+	config, _ := structpb.NewStruct(map[string]any{"directory": t.TempDir()})
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "recursiv") {
+		t.Errorf("Expected InvalidArgument naming the unknown key, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Control paths are reserved Fetch paths whose first segment is wrapped in
+// double underscores (e.g. ["__config__"]). They expose diagnostics and
+// operations that the ProviderService contract has no dedicated RPC for.
+//
+// Control paths take precedence over files, so a file named "__config__.csl"
+// cannot be fetched directly.
+const (
+	controlConfig     = "__config__"
+	controlRecent     = "__recent__"
+	controlDiff       = "__diff__"
+	controlSet        = "__set__"
+	controlMetrics    = "__metrics__"
+	controlManifest   = "__manifest__"
+	controlExists     = "__exists__"
+	controlDebug      = "__debug__"
+	controlPaths      = "__paths__"
+	controlWarnings   = "__warnings__"
+	controlDeps       = "__deps__"
+	controlWhere      = "__where__"
+	controlBundle     = "__bundle__"
+	controlSchemaJSON = "__schema_json__"
+	controlSections   = "__sections__"
+)
+
+// controlHandler serves a control path. args holds the path segments that
+// follow the control segment. Handlers run with the service read lock held.
+type controlHandler func(s *FileProviderService, ctx context.Context, args []string) (any, error)
+
+var controlHandlers = map[string]controlHandler{
+	controlConfig:     (*FileProviderService).fetchConfig,
+	controlRecent:     (*FileProviderService).fetchRecent,
+	controlDiff:       (*FileProviderService).fetchDiff,
+	controlSet:        (*FileProviderService).fetchSet,
+	controlMetrics:    (*FileProviderService).fetchMetrics,
+	controlManifest:   (*FileProviderService).fetchManifest,
+	controlExists:     (*FileProviderService).fetchExists,
+	controlDebug:      (*FileProviderService).fetchDebug,
+	controlPaths:      (*FileProviderService).fetchPaths,
+	controlWarnings:   (*FileProviderService).fetchWarnings,
+	controlDeps:       (*FileProviderService).fetchDeps,
+	controlWhere:      (*FileProviderService).fetchWhere,
+	controlBundle:     (*FileProviderService).fetchBundle,
+	controlSchemaJSON: (*FileProviderService).fetchSchemaJSON,
+	controlSections:   (*FileProviderService).fetchSections,
+}
+
+// fetchConfig returns the effective configuration of the provider.
+func (s *FileProviderService) fetchConfig(ctx context.Context, args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s does not accept arguments", controlConfig)
+	}
+
+	return s.config.effective(), nil
+}
+
+// fetchRecent returns the N most recently modified files, newest first.
+//
+// Path: ["__recent__", "N"]. Ties are broken by base name. Files are statted
+// on every call so the result reflects changes made since Init.
+func (s *FileProviderService) fetchRecent(ctx context.Context, args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects exactly one argument (count)", controlRecent)
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s count must be a positive integer, got %q", controlRecent, args[0])
+	}
+	if s.config.scan.lazy {
+		return nil, errLazyScan(controlRecent)
+	}
+
+	type recentFile struct {
+		baseName string
+		modTime  time.Time
+	}
+
+	files := make([]recentFile, 0, len(s.config.cslFiles))
+	for baseName, filePath := range s.config.cslFiles {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to stat file %q: %v", baseName, err)
+		}
+		files = append(files, recentFile{baseName: baseName, modTime: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].baseName < files[j].baseName
+	})
+
+	if len(files) > n {
+		files = files[:n]
+	}
+
+	result := make([]any, len(files))
+	for i, f := range files {
+		result[i] = map[string]any{
+			"name":     f.baseName,
+			"modified": f.modTime.UTC().Format(time.RFC3339Nano),
+		}
+	}
+
+	return result, nil
+}
+
+// fetchDiff returns the structural diff between two files.
+//
+// Path: ["__diff__", "a", "b"], where a and b are file keys as used by Fetch
+// (e.g. "database" or, with roots, "tenantA/database").
+func (s *FileProviderService) fetchDiff(ctx context.Context, args []string) (any, error) {
+	if len(args) != 2 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects exactly two file names", controlDiff)
+	}
+
+	trees := make([]map[string]any, len(args))
+	for i, key := range args {
+		filePath, exists := s.config.lookupFile(key)
+		if !exists {
+			return nil, status.Errorf(codes.NotFound, "file %q not found", key)
+		}
+
+		data, err := s.loadFile(filePath)
+		if err != nil {
+			return nil, parseStatus(fmt.Sprintf("failed to parse file %q", key), err)
+		}
+
+		// A file without fetch_root diffs as empty
+		data, _ = lookupPath(data, s.scopedKeys(filePath, nil))
+		tree, ok := data.(map[string]any)
+		if !ok && data != nil {
+			return nil, status.Errorf(codes.Internal, "file %q did not return a map", key)
+		}
+		trees[i] = tree
+	}
+
+	return diffMaps(trees[0], trees[1]).toMap(), nil
+}
@@ -0,0 +1,953 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestInfo_ReportsAliasAfterInit(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app: { name: test }"}, nil)
+
+	resp, err := svc.Info(context.Background(), &providerv1.InfoRequest{})
+	if err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+
+	if resp.Alias != "test" {
+		t.Errorf("Expected alias 'test', got %q", resp.Alias)
+	}
+}
+
+func TestFetch_ControlConfig(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "app: { name: test }"}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__config__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if data["alias"] != "test" {
+		t.Errorf("Expected alias 'test', got %v", data["alias"])
+	}
+	if data["directory"] != tmpDir {
+		t.Errorf("Expected directory %q, got %v", tmpDir, data["directory"])
+	}
+
+	if got := svc.EffectiveConfig(); got["directory"] != tmpDir {
+		t.Errorf("Expected EffectiveConfig directory %q, got %v", tmpDir, got["directory"])
+	}
+}
+
+func TestFetch_ControlRecent(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"old.csl":    "app: { name: old }",
+		"middle.csl": "app: { name: middle }",
+		"new.csl":    "app: { name: new }",
+	}, nil)
+
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"old", "middle", "new"} {
+		modTime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(tmpDir, name+".csl"), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__recent__", "2"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	files := resp.Value.AsMap()["value"].([]any)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+
+	for i, want := range []string{"new", "middle"} {
+		entry := files[i].(map[string]any)
+		if entry["name"] != want {
+			t.Errorf("Expected files[%d] to be %q, got %v", i, want, entry["name"])
+		}
+		if entry["modified"] == "" {
+			t.Errorf("Expected files[%d] to have a modtime", i)
+		}
+	}
+}
+
+func TestFetch_ControlRecentInvalidCount(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app: { name: test }"}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__recent__", "zero"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestFetch_ControlDiff(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"before.csl": "database:\n  host: localhost\n  port: '5432'\n",
+		"after.csl":  "database:\n  host: db.internal\n  port: '5432'\n  user: admin\n",
+	}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__diff__", "before", "after"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+
+	added := data["added"].(map[string]any)
+	if added["database.user"] != "admin" {
+		t.Errorf("Expected database.user to be added, got %v", added)
+	}
+
+	changed := data["changed"].(map[string]any)
+	host, ok := changed["database.host"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected database.host to be changed, got %v", changed)
+	}
+	if host["from"] != "localhost" || host["to"] != "db.internal" {
+		t.Errorf("Unexpected database.host change: %v", host)
+	}
+	if _, ok := changed["database.port"]; ok {
+		t.Errorf("Expected database.port to be unchanged")
+	}
+
+	if removed := data["removed"].(map[string]any); len(removed) != 0 {
+		t.Errorf("Expected no removed keys, got %v", removed)
+	}
+}
+
+func TestFetch_ControlSet(t *testing.T) {
+	content := "# database settings\ndatabase:\n  host: localhost # primary\n  name: 'app db'\n"
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"config.csl": content,
+	}, map[string]any{"allow_write": true})
+
+	for _, path := range [][]string{
+		{"__set__", "config", "database", "host", "db.internal"},
+		{"__set__", "config", "database", "name", "prod db"},
+	} {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: path}); err != nil {
+			t.Fatalf("Fetch %v failed: %v", path, err)
+		}
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data := resp.Value.AsMap()
+	if data["host"] != "db.internal" {
+		t.Errorf("Expected host 'db.internal', got %v", data["host"])
+	}
+	if data["name"] != "prod db" {
+		t.Errorf("Expected name 'prod db', got %v", data["name"])
+	}
+
+	written, err := os.ReadFile(filepath.Join(tmpDir, "config.csl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# database settings\ndatabase:\n  host: db.internal # primary\n  name: 'prod db'\n"
+	if string(written) != want {
+		t.Errorf("Expected formatting and comments to be preserved, got:\n%s", written)
+	}
+}
+
+func TestFetch_ControlSetSameSizeValue(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"config.csl": "app:\n  port: 8080\n",
+	}, map[string]any{"allow_write": true})
+	filePath := filepath.Join(tmpDir, "config.csl")
+
+	fetchPort := func() any {
+		t.Helper()
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "port"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		return resp.Value.AsMap()["value"]
+	}
+	if got := fetchPort(); got != "8080" {
+		t.Fatalf("Expected port 8080, got %v", got)
+	}
+	before, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__set__", "config", "app", "port", "9090"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	// Simulate a write within one modtime tick: same size, same modtime
+	if err := os.Chtimes(filePath, before.ModTime(), before.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fetchPort(); got != "9090" {
+		t.Errorf("Expected the written port 9090, got %v", got)
+	}
+}
+
+func TestFetch_ControlSetUsesServiceParser(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "app:\n  port: 8080\n",
+	}, map[string]any{"allow_write": true})
+	svc.parser = fakeParser{err: errors.New("crafted failure")}
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__set__", "config", "app", "port", "9090"}})
+	if status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), "crafted failure") {
+		t.Errorf("Expected FailedPrecondition wrapping the parser error, got %v", err)
+	}
+}
+
+func TestFetch_ControlSetQuotesValues(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"config.csl": "app:\n  plain: x\n  single: 'x'\n",
+	}, map[string]any{"allow_write": true})
+
+	tests := []struct {
+		key, value, want string
+	}{
+		{"plain", "db.internal", "plain: db.internal"},
+		{"plain", "host:5432", `plain: "host:5432"`},
+		{"plain", "a#b", `plain: "a#b"`},
+		{"plain", "a@b", `plain: "a@b"`},
+		{"plain", `say "hi"`, `plain: 'say "hi"'`},
+		{"single", "it's", `single: "it's"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__set__", "config", "app", tt.key, tt.value}}); err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+
+			written, err := os.ReadFile(filepath.Join(tmpDir, "config.csl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(written), "  "+tt.want+"\n") {
+				t.Errorf("Expected %s in the file, got:\n%s", tt.want, written)
+			}
+
+			// The value reads back as written
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", tt.key}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if got := resp.Value.AsMap()["value"]; got != tt.value {
+				t.Errorf("Expected %q to read back, got %v", tt.value, got)
+			}
+		})
+	}
+
+	for _, value := range []string{"a\nb", `it's "x"`, "@alias:path"} {
+		_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__set__", "config", "app", "plain", value}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %q, got %v", value, err)
+		}
+	}
+}
+
+func TestFetch_ControlSetThroughSymlink(t *testing.T) {
+	targetDir := t.TempDir()
+	target := filepath.Join(targetDir, "shared.csl")
+	if err := os.WriteFile(target, []byte("app:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	link := filepath.Join(tmpDir, "config.csl")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "allow_write": true, "jail_to_root": false})
+	svc := NewFileProviderService("0.1.0", "file")
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__set__", "config", "app", "host", "db.internal"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be kept")
+	}
+	written, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "app:\n  host: db.internal\n" {
+		t.Errorf("Expected the target to be rewritten, got:\n%s", written)
+	}
+}
+
+func TestFetch_ControlSetActiveVariant(t *testing.T) {
+	content := "dev:\n  database:\n    host: dev.local\nprod:\n  database:\n    host: prod.local\n"
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"config.csl": content,
+	}, map[string]any{"allow_write": true, "active_variant": "prod"})
+
+	path := []string{"__set__", "config", "database", "host", "db.internal"}
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: path}); err != nil {
+		t.Fatalf("Fetch %v failed: %v", path, err)
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database", "host"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "db.internal" {
+		t.Errorf("Expected the write to be visible within the variant, got %v", got)
+	}
+
+	written, err := os.ReadFile(filepath.Join(tmpDir, "config.csl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "dev:\n  database:\n    host: dev.local\nprod:\n  database:\n    host: db.internal\n"
+	if string(written) != want {
+		t.Errorf("Expected only the prod variant to change, got:\n%s", written)
+	}
+}
+
+func TestFetch_ControlSetDisabled(t *testing.T) {
+	content := "database:\n  host: localhost\n"
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{
+		Path: []string{"__set__", "config", "database", "host", "db.internal"},
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+
+	written, err := os.ReadFile(filepath.Join(tmpDir, "config.csl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != content {
+		t.Errorf("Expected file to be unchanged, got:\n%s", written)
+	}
+}
+
+func TestFetch_ControlMetrics(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"a.csl": "name: a",
+		"b.csl": "name: b",
+		"c.csl": "name: c",
+	}, map[string]any{"cache_max_entries": 2})
+
+	for _, name := range []string{"a", "b", "c", "c"} {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{name}}); err != nil {
+			t.Fatalf("Fetch %q failed: %v", name, err)
+		}
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__metrics__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]float64{
+		"cache_entries":         2,
+		"cache_evictions_total": 1,
+		"cache_hits_total":      1,
+		"cache_misses_total":    3,
+	}
+	data := resp.Value.AsMap()
+	for name, value := range want {
+		if data[name] != value {
+			t.Errorf("Expected %s %v, got %v", name, value, data[name])
+		}
+	}
+
+	var buf strings.Builder
+	if err := svc.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	for _, line := range []string{
+		"# TYPE nomos_provider_file_cache_entries gauge\n",
+		"nomos_provider_file_cache_entries 2\n",
+		"nomos_provider_file_cache_evictions_total 1\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected metrics output to contain %q, got:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestFetch_ContextEndMetrics(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n", "other.csl": "app:\n  name: other\n"}, nil)
+	req := &providerv1.FetchRequest{Path: []string{"config", "app"}}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := svc.Fetch(cancelled, req); status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Fetch(expired, req); status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("Expected DeadlineExceeded, got %v", err)
+		}
+	}
+
+	if _, err := svc.Fetch(context.Background(), req); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	// A failure unrelated to the context is not counted, even when the
+	// context has ended by the time it is returned
+	ended, cancel := context.WithCancel(context.Background())
+	svc.readFile = func(name string) ([]byte, error) {
+		cancel()
+		return nil, os.ErrPermission
+	}
+	if _, err := svc.Fetch(ended, &providerv1.FetchRequest{Path: []string{"other", "app"}}); err == nil || status.Code(err) == codes.Canceled {
+		t.Fatalf("Expected a read failure, got %v", err)
+	}
+	svc.readFile = os.ReadFile
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__metrics__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data := resp.Value.AsMap()
+	if data["fetch_cancelled_total"] != float64(1) {
+		t.Errorf("Expected fetch_cancelled_total 1, got %v", data["fetch_cancelled_total"])
+	}
+	if data["fetch_deadline_exceeded_total"] != float64(2) {
+		t.Errorf("Expected fetch_deadline_exceeded_total 2, got %v", data["fetch_deadline_exceeded_total"])
+	}
+}
+
+func TestFetch_AllFilesDoesNotMutateCache(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"a.csl": "app:\n  name: a\n",
+		"b.csl": "app:\n  port: 80\n",
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"*"}}); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"a", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if _, ok := resp.Value.AsMap()["port"]; ok {
+		t.Errorf("Expected cached file a to be unaffected by merging, got %v", resp.Value.AsMap())
+	}
+}
+
+func TestFetch_ControlManifest(t *testing.T) {
+	files := map[string]string{
+		"b.csl": "name: b",
+		"a.csl": "name: a",
+		"c.csl": "name: c",
+	}
+	svc, tmpDir := newInitializedService(t, files, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__manifest__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	entries, ok := data["files"].([]any)
+	if !ok || len(entries) != len(files) {
+		t.Fatalf("Expected %d manifest entries, got %v", len(files), data["files"])
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		entry := entries[i].(map[string]any)
+		hash, err := fileHash(filepath.Join(tmpDir, name+".csl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry["name"] != name || entry["path"] != name+".csl" {
+			t.Errorf("Entry %d: expected %s at %s.csl, got %v", i, name, name, entry)
+		}
+		if entry["sha256"] != hash {
+			t.Errorf("Entry %d: expected hash %s, got %v", i, hash, entry["sha256"])
+		}
+		if entry["size"] != float64(len(files[name+".csl"])) {
+			t.Errorf("Entry %d: expected size %d, got %v", i, len(files[name+".csl"]), entry["size"])
+		}
+	}
+
+	if digest, _ := data["digest"].(string); len(digest) != 64 {
+		t.Errorf("Expected hex SHA-256 digest, got %v", data["digest"])
+	}
+}
+
+func TestFetch_ControlExists(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "database:\n  host: localhost\n  replicas:\n    - r1\n    - r2\n"}, nil)
+
+	tests := []struct {
+		path []string
+		want bool
+	}{
+		{[]string{"config", "database", "host"}, true},
+		{[]string{"config", "database"}, true},
+		{[]string{"config", "database", "port"}, false},
+		{[]string{"config", "database", "host", "deeper"}, false},
+		{[]string{"missing", "database"}, false},
+		{[]string{"config", "database", "*"}, true},
+		{[]string{"config", "database", "replicas", "*"}, true},
+		{[]string{"config", "database", "host", "*"}, false},
+	}
+
+	for _, tt := range tests {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: append([]string{"__exists__"}, tt.path...)})
+		if err != nil {
+			t.Fatalf("Exists %v failed: %v", tt.path, err)
+		}
+		if got := resp.Value.AsMap()["exists"]; got != tt.want {
+			t.Errorf("Exists %v: expected %v, got %v", tt.path, tt.want, got)
+		}
+
+		// Fetch agrees
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path}); (err == nil) != tt.want {
+			t.Errorf("Fetch %v: expected success %v, got %v", tt.path, tt.want, err)
+		}
+	}
+}
+
+func TestFetch_ControlExistsNavigationOptions(t *testing.T) {
+	files := map[string]string{
+		"database.csl": "db:\n  primary:\n    host: db.local\n",
+		"app.csl":      "app:\n  db: @test:database.db.primary\n  name: api\n",
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]any
+		path   []string
+		want   bool
+	}{
+		{"reference followed", map[string]any{"follow_references": true}, []string{"app", "app", "db", "host"}, true},
+		{"reference followed to a missing key", map[string]any{"follow_references": true}, []string{"app", "app", "db", "port"}, false},
+		{"reference not followed", nil, []string{"app", "app", "db", "host"}, false},
+		{"value wrapper descended", map[string]any{"descend_value_wrapper": true}, []string{"app", "app", "name", "value"}, true},
+		{"value wrapper not descended", nil, []string{"app", "app", "name", "value"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newInitializedService(t, files, tt.config)
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: append([]string{"__exists__"}, tt.path...)})
+			if err != nil {
+				t.Fatalf("Exists %v failed: %v", tt.path, err)
+			}
+			if got := resp.Value.AsMap()["exists"]; got != tt.want {
+				t.Errorf("Exists %v: expected %v, got %v", tt.path, tt.want, got)
+			}
+
+			// Fetch agrees
+			if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path}); (err == nil) != tt.want {
+				t.Errorf("Fetch %v: expected success %v, got %v", tt.path, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFetch_ControlDebug(t *testing.T) {
+	t.Setenv(debugEnvVar, "1")
+
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"database.csl": "db:\n  host: localhost\n",
+		"app.csl":      "app:\n  name: test\n",
+	}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__debug__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	want := map[string]any{
+		"database": filepath.Join(tmpDir, "database.csl"),
+		"app":      filepath.Join(tmpDir, "app.csl"),
+	}
+	if !reflect.DeepEqual(data["files"], want) {
+		t.Errorf("Expected file map %v, got %v", want, data["files"])
+	}
+	if files := data["stats"].(map[string]any)["files"]; files != float64(2) {
+		t.Errorf("Expected 2 files in stats, got %v", files)
+	}
+}
+
+func TestFetch_ControlDebugDisabledByDefault(t *testing.T) {
+	t.Setenv(debugEnvVar, "")
+
+	svc, _ := newInitializedService(t, map[string]string{"app.csl": "app:\n  name: test\n"}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__debug__"}})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestFetch_ControlPaths(t *testing.T) {
+	content := "database:\n  primary:\n    host: db.local\n    port: 5432\n  replicas:\n    - r1\n    - r2\napp:\n  name: test\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__paths__", "config"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	wantLeaves := []any{"app.name", "database.primary.host", "database.primary.port", "database.replicas"}
+	if !reflect.DeepEqual(data["leaves"], wantLeaves) {
+		t.Errorf("Expected leaves %v, got %v", wantLeaves, data["leaves"])
+	}
+	wantMaps := []any{"app", "database", "database.primary"}
+	if !reflect.DeepEqual(data["maps"], wantMaps) {
+		t.Errorf("Expected maps %v, got %v", wantMaps, data["maps"])
+	}
+	if data["truncated"] != false {
+		t.Errorf("Expected no truncation, got %v", data["truncated"])
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__paths__", "config", "database", "primary"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got, want := resp.Value.AsMap()["leaves"], []any{"database.primary.host", "database.primary.port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected leaves %v beneath the fetched node, got %v", want, got)
+	}
+}
+
+func TestPathWalker_MaxDepth(t *testing.T) {
+	var deep any = "leaf"
+	for i := 0; i < pathsMaxDepth+5; i++ {
+		deep = map[string]any{"k": deep}
+	}
+
+	w := pathWalker{}
+	w.walk(deep, nil, 0)
+	if !w.truncated {
+		t.Error("Expected the walk to be truncated at the max depth")
+	}
+	if len(w.leaves) != 0 || len(w.maps) != pathsMaxDepth {
+		t.Errorf("Expected %d maps and no leaves, got %d maps and %d leaves", pathsMaxDepth, len(w.maps), len(w.leaves))
+	}
+}
+
+func TestFetch_ControlWarningsSourceAliasMismatch(t *testing.T) {
+	files := map[string]string{
+		"other.csl": "source:\n  alias: 'configs'\n  type: 'file'\n  directory: './configs'\n\napp:\n  name: test\n",
+		"same.csl":  "source:\n  alias: 'test'\n  type: 'file'\n  directory: './configs'\n\napp:\n  name: test\n",
+		"net.csl":   "source:\n  alias: 'network'\n  type: 'folder'\n  path: './network'\n\napp:\n  name: test\n",
+	}
+	svc, _ := newInitializedService(t, files, map[string]any{"check_source_alias": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__warnings__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	warnings, _ := resp.Value.AsMap()["warnings"].([]any)
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+	warning, _ := warnings[0].(map[string]any)
+	if warning["kind"] != "source_alias_mismatch" || warning["file"] != "other" || warning["declared"] != "configs" || warning["alias"] != "test" {
+		t.Errorf("Unexpected warning %v", warning)
+	}
+	if warning["line"] != float64(1) {
+		t.Errorf("Expected warning on line 1, got %v", warning["line"])
+	}
+
+	// Without the option nothing is checked
+	svc, _ = newInitializedService(t, files, nil)
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__warnings__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if warnings, _ := resp.Value.AsMap()["warnings"].([]any); len(warnings) != 0 {
+		t.Errorf("Expected no warnings without check_source_alias, got %v", warnings)
+	}
+}
+
+func TestFetch_ControlDeps(t *testing.T) {
+	content := "app:\n  cidr: @network:vpc.cidr\n  db:\n    primary: @test:database.primary\n    replica:\n      host: @test:database.primary\n  peers:\n    - @network:vpc.peer\n"
+
+	for _, refFormat := range []string{refFormatString, refFormatStruct} {
+		t.Run(refFormat, func(t *testing.T) {
+			svc, _ := newInitializedService(t, map[string]string{"app.csl": content}, map[string]any{"ref_format": refFormat})
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__deps__", "app"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+
+			want := []any{
+				map[string]any{"alias": "network", "path": []any{"vpc", "cidr"}},
+				map[string]any{"alias": "network", "path": []any{"vpc", "peer"}},
+				map[string]any{"alias": "test", "path": []any{"database", "primary"}},
+			}
+			if got := resp.Value.AsMap()["dependencies"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected dependencies %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFetch_ControlWhere(t *testing.T) {
+	files := map[string]string{
+		"api.csl":    "app:\n  enabled: true\n",
+		"worker.csl": "app:\n  enabled: true\n  replicas: 2\n",
+		"legacy.csl": "app:\n  enabled: false\n",
+	}
+	svc, _ := newInitializedService(t, files, nil)
+
+	tests := []struct {
+		path []string
+		want []any
+	}{
+		{path: []string{"__where__", "app.enabled", "==", "true"}, want: []any{"api", "worker"}},
+		{path: []string{"__where__", "app.enabled", "!=", "true"}, want: []any{"legacy"}},
+		{path: []string{"__where__", "app.replicas", "exists"}, want: []any{"worker"}},
+		{path: []string{"__where__", "app", "==", "true"}, want: []any{}},
+	}
+
+	for _, tt := range tests {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path})
+		if err != nil {
+			t.Fatalf("Fetch %q failed: %v", tt.path, err)
+		}
+		if got := resp.Value.AsMap()["files"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Fetch %q: expected files %v, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__where__", "app.enabled", "~", "true"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown operator, got %v", err)
+	}
+}
+
+func TestFetch_ControlBundleRoundTrips(t *testing.T) {
+	files := map[string]string{
+		"api.csl":      "app:\n  name: api\n  ports:\n    - 80\n    - 443\n",
+		"database.csl": "database:\n  host: localhost\n  pool:\n    max: 10\n",
+	}
+	svc, _ := newInitializedService(t, files, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__bundle__"}})
+	if err != nil {
+		t.Fatalf("Fetch bundle failed: %v", err)
+	}
+	encoded := resp.Value.AsMap()["bundle"].(string)
+	if got := resp.Value.AsMap()["files"]; got != float64(2) {
+		t.Errorf("Expected 2 files, got %v", got)
+	}
+
+	var bundle map[string]any
+	if err := json.Unmarshal([]byte(encoded), &bundle); err != nil {
+		t.Fatalf("Expected a JSON bundle, got %q: %v", encoded, err)
+	}
+	if len(bundle) != len(files) {
+		t.Fatalf("Expected %d files in the bundle, got %v", len(files), bundle)
+	}
+
+	// Each file split back out of the bundle matches a direct fetch
+	for name, data := range bundle {
+		fileResp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{name}})
+		if err != nil {
+			t.Fatalf("Fetch %q failed: %v", name, err)
+		}
+		if want := fileResp.Value.AsMap(); !reflect.DeepEqual(data, want) {
+			t.Errorf("Bundle entry %q = %v, want %v", name, data, want)
+		}
+	}
+
+	again, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__bundle__"}})
+	if err != nil {
+		t.Fatalf("Second bundle fetch failed: %v", err)
+	}
+	if again.Value.AsMap()["bundle"] != encoded {
+		t.Error("Expected identical bundle bytes on every call")
+	}
+}
+
+func TestFetch_ControlBundleSizeLimit(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"},
+		map[string]any{"max_bundle_bytes": 10})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__bundle__"}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted for an oversized bundle, got %v", err)
+	}
+}
+
+func TestFetch_ControlSchemaJSON(t *testing.T) {
+	content := "app:\n  name: api\n  port: 8080\n  ratio: 0.5\n  debug: true\n  hosts:\n    - a.example.com\n    - b.example.com\n  limits:\n    cpu: 2\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__schema_json__", "config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string"},
+			"port":  map[string]any{"type": "integer"},
+			"ratio": map[string]any{"type": "number"},
+			"debug": map[string]any{"type": "boolean"},
+			"hosts": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"limits": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"cpu": map[string]any{"type": "integer"}},
+				"required":   []any{"cpu"},
+			},
+		},
+		"required": []any{"debug", "hosts", "limits", "name", "port", "ratio"},
+	}
+	if got := resp.Value.AsMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected schema %v, got %v", want, got)
+	}
+
+	_, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__schema_json__"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without a file path, got %v", err)
+	}
+}
+
+func TestFetch_ControlSections(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"api.csl":      "region: us-west-2\napp:\n  name: api\ndatabase:\n  host: db\nlogging:\n  level: info\n",
+		"worker.csl":   "app:\n  name: worker\n",
+		"settings.csl": "region: us-east-1\n",
+	}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__sections__"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	want := map[string]any{"api": float64(3), "worker": float64(1), "settings": float64(0)}
+	if got := resp.Value.AsMap()["files"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected section counts %v, got %v", want, got)
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__sections__", "api"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["files"]; !reflect.DeepEqual(got, map[string]any{"api": float64(3)}) {
+		t.Errorf("Expected only api's count, got %v", got)
+	}
+
+	_, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__sections__", "missing"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown file, got %v", err)
+	}
+}
+
+func TestSnapshotMetrics_Reset(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+
+	snapshot := svc.SnapshotMetrics(true)
+	if snapshot["cache_misses_total"] != 1 || snapshot["cache_hits_total"] != 2 {
+		t.Errorf("Expected 1 miss and 2 hits, got %v", snapshot)
+	}
+
+	after := svc.SnapshotMetrics(false)
+	if after["cache_misses_total"] != 0 || after["cache_hits_total"] != 0 {
+		t.Errorf("Expected counters to start fresh after reset, got %v", after)
+	}
+	if after["cache_entries"] != 1 {
+		t.Errorf("Expected gauges to survive a reset, got cache_entries %v", after["cache_entries"])
+	}
+
+	// The control path resets too
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"__metrics__", "reset"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["cache_hits_total"]; got != float64(1) {
+		t.Errorf("Expected the reset snapshot to report 1 hit, got %v", got)
+	}
+	if got := svc.SnapshotMetrics(false)["cache_hits_total"]; got != 0 {
+		t.Errorf("Expected hits to be reset by the control path, got %v", got)
+	}
+}
+
+func TestSnapshotMetrics_ResetLosesNoIncrements(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	const workers, fetches = 4, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < fetches; i++ {
+				svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var total float64
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		snapshot := svc.SnapshotMetrics(true)
+		total += snapshot["cache_hits_total"] + snapshot["cache_misses_total"]
+	}
+
+	if total != workers*fetches {
+		t.Errorf("Expected %d parses across snapshots, got %v", workers*fetches, total)
+	}
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// debugEnvVar enables the __debug__ control path when set to "1". It is off
+// by default because the dump exposes absolute paths on the host.
+const debugEnvVar = "NOMOS_PROVIDER_DEBUG"
+
+// fetchDebug returns the provider's internal file map (base name -> absolute
+// path) and basic stats, for support during incidents.
+//
+// Path: ["__debug__"]. It fails with PermissionDenied unless the provider was
+// started with NOMOS_PROVIDER_DEBUG=1. In lazy_scan mode the file map is
+// empty, as files are resolved on demand.
+func (s *FileProviderService) fetchDebug(ctx context.Context, args []string) (any, error) {
+	if !s.debug {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is disabled; set %s=1 to enable it", controlDebug, debugEnvVar)
+	}
+	if len(args) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s does not accept arguments", controlDebug)
+	}
+
+	files := make(map[string]any, len(s.config.cslFiles))
+	for baseName, filePath := range s.config.cslFiles {
+		files[baseName] = filePath
+	}
+
+	stats := map[string]any{
+		"files": len(s.config.cslFiles),
+		"roots": len(s.config.roots),
+		"lazy":  s.config.scan.lazy,
+	}
+	for _, m := range s.metricSamples(false) {
+		stats[m.name] = m.value
+	}
+
+	return map[string]any{"files": files, "stats": stats}, nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchDeps lists the references a file depends on.
+//
+// Path: ["__deps__", <fetch path>...], e.g. ["__deps__", "app"] or
+// ["__deps__", "app", "database"]. Every reference beneath the fetched node,
+// at any depth and in either ref_format, is collected into
+// {"dependencies": [{"alias": ..., "path": [...]}, ...]}. Identical
+// references are listed once, sorted by alias and then path.
+func (s *FileProviderService) fetchDeps(ctx context.Context, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a file path", controlDeps)
+	}
+
+	target, err := s.resolveTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	if target.all {
+		return nil, status.Errorf(codes.InvalidArgument, `%s does not support path ["*"]`, controlDeps)
+	}
+
+	data, err := s.loadFile(target.filePath)
+	if err != nil {
+		return nil, parseStatus("failed to parse file", err)
+	}
+	data, err = s.navigate(data, s.scopedKeys(target.filePath, target.keys), args)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]reference)
+	collectReferences(data, seen)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deps := make([]any, len(names))
+	for i, name := range names {
+		ref := seen[name]
+		deps[i] = map[string]any{
+			"alias": ref.alias,
+			"path":  stringsToAny(ref.path),
+		}
+	}
+	return map[string]any{"dependencies": deps}, nil
+}
+
+// collectReferences adds every reference in v to seen, keyed by its source
+// form so duplicates collapse.
+func collectReferences(v any, seen map[string]reference) {
+	if ref, ok := referenceOf(v); ok {
+		seen[ref.String()] = ref
+		return
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, child := range val {
+			collectReferences(child, seen)
+		}
+	case []any:
+		for _, child := range val {
+			collectReferences(child, seen)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"reflect"
+	"sort"
+)
+
+// structuralDiff describes the differences between two converted files.
+// Nested changes are keyed by their dotted path (e.g. "database.host").
+type structuralDiff struct {
+	added   map[string]any
+	removed map[string]any
+	changed map[string]any
+}
+
+// diffMaps computes the structural diff from a to b. Maps are compared key by
+// key; any other values (including lists) are compared as a whole.
+func diffMaps(a, b map[string]any) *structuralDiff {
+	d := &structuralDiff{
+		added:   make(map[string]any),
+		removed: make(map[string]any),
+		changed: make(map[string]any),
+	}
+	d.walk("", a, b)
+	return d
+}
+
+func (d *structuralDiff) walk(prefix string, a, b map[string]any) {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := key
+		if prefix != "" {
+			keyPath = prefix + "." + key
+		}
+
+		aValue, inA := a[key]
+		bValue, inB := b[key]
+
+		switch {
+		case !inA:
+			d.added[keyPath] = bValue
+		case !inB:
+			d.removed[keyPath] = aValue
+		default:
+			aMap, aIsMap := aValue.(map[string]any)
+			bMap, bIsMap := bValue.(map[string]any)
+			if aIsMap && bIsMap {
+				d.walk(keyPath, aMap, bMap)
+				continue
+			}
+
+			if !reflect.DeepEqual(aValue, bValue) {
+				d.changed[keyPath] = map[string]any{"from": aValue, "to": bValue}
+			}
+		}
+	}
+}
+
+// toMap returns the diff in the shape returned to consumers.
+func (d *structuralDiff) toMap() map[string]any {
+	return map[string]any{
+		"added":   d.added,
+		"removed": d.removed,
+		"changed": d.changed,
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Environment config overrides.
+//
+// Orchestrators override Init config keys without editing source files by
+// setting NOMOS_PROVIDER_CONFIG_<KEY>, where <KEY> is the config key in upper
+// case (e.g. NOMOS_PROVIDER_CONFIG_DIRECTORY, NOMOS_PROVIDER_CONFIG_MAX_DEPTH).
+// A value that parses as JSON (true, 42, ["a"], {"k": "v"}) is used as that
+// JSON value; anything else is used as a plain string. Overridden keys are
+// validated like any other config, so an unknown key fails Init.
+//
+// NOMOS_PROVIDER_CONFIG_PRECEDENCE selects who wins when both set a key:
+// "env" (the default) or "config".
+const (
+	envConfigPrefix        = "NOMOS_PROVIDER_CONFIG_"
+	envConfigPrecedenceVar = "NOMOS_PROVIDER_CONFIG_PRECEDENCE"
+)
+
+// Values of NOMOS_PROVIDER_CONFIG_PRECEDENCE.
+const (
+	envPrecedenceEnv    = "env"
+	envPrecedenceConfig = "config"
+)
+
+// applyEnvConfig merges the NOMOS_PROVIDER_CONFIG_<KEY> overrides into
+// configMap, honoring NOMOS_PROVIDER_CONFIG_PRECEDENCE.
+func applyEnvConfig(configMap map[string]any) error {
+	precedence := os.Getenv(envConfigPrecedenceVar)
+	switch precedence {
+	case "":
+		precedence = envPrecedenceEnv
+	case envPrecedenceEnv, envPrecedenceConfig:
+	default:
+		return status.Errorf(codes.InvalidArgument, "%s must be %q or %q, got %q",
+			envConfigPrecedenceVar, envPrecedenceEnv, envPrecedenceConfig, precedence)
+	}
+
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		suffix, ok := strings.CutPrefix(name, envConfigPrefix)
+		if !ok || name == envConfigPrecedenceVar || suffix == "" {
+			continue
+		}
+
+		key := strings.ToLower(suffix)
+		if _, exists := configMap[key]; exists && precedence == envPrecedenceConfig {
+			continue
+		}
+		configMap[key] = envConfigValue(value)
+	}
+	return nil
+}
+
+// envConfigValue decodes an override as JSON, falling back to the raw string.
+func envConfigValue(value string) any {
+	var decoded any
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
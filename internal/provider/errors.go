@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain identifies this provider in ErrorInfo details.
+const errorDomain = "nomos-provider-file"
+
+// Machine-readable reasons attached to errors as ErrorInfo details, so callers
+// can distinguish failures that share a gRPC code.
+const (
+	reasonNotInitialized    = "PROVIDER_NOT_INITIALIZED"
+	reasonAmbiguousWildcard = "AMBIGUOUS_WILDCARD"
+	reasonPathAmbiguous     = "PATH_AMBIGUOUS"
+	reasonNotNavigable      = "NOT_NAVIGABLE"
+)
+
+// errorWithReason returns a status error carrying an ErrorInfo detail with the
+// given reason and optional metadata.
+func errorWithReason(code codes.Code, reason, msg string, metadata map[string]string) error {
+	st := status.New(code, msg)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		// Details only fail to attach if the message cannot be marshaled;
+		// fall back to the plain status rather than losing the error.
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// errNotInitialized is returned by operations that require Init.
+func errNotInitialized() error {
+	return errorWithReason(codes.FailedPrecondition, reasonNotInitialized,
+		"provider not initialized: call Init with a valid configuration before Fetch", nil)
+}
+
+// errNotNavigable is returned when navigation meets a node it cannot descend
+// into: a value that is not a map, or a reference that is not followed.
+func errNotNavigable(format string, args ...any) error {
+	return errorWithReason(codes.InvalidArgument, reasonNotNavigable, fmt.Sprintf(format, args...), nil)
+}
+
+// hasReason reports whether err carries an ErrorInfo detail with reason.
+func hasReason(err error, reason string) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// errAmbiguousWildcard is returned when a trailing "*" is applied to a value
+// that has no children. The ErrorInfo metadata names the value's type.
+func errAmbiguousWildcard(value any) error {
+	typ := fmt.Sprintf("%T", value)
+	return errorWithReason(codes.InvalidArgument, reasonAmbiguousWildcard,
+		fmt.Sprintf("cannot expand: a wildcard can only be applied to a map or list, target is %s", typ),
+		map[string]string{"type": typ})
+}
+
+// errPathAmbiguous is returned when a fetched file key names more than one
+// file. The ErrorInfo metadata lists the conflicting files, relative to their
+// directory, as "file_1", "file_2", and so on.
+func errPathAmbiguous(key string, files []string) error {
+	metadata := make(map[string]string, len(files))
+	for i, file := range files {
+		metadata[fmt.Sprintf("file_%d", i+1)] = file
+	}
+	return errorWithReason(codes.AlreadyExists, reasonPathAmbiguous,
+		fmt.Sprintf("file key %q is ambiguous: it names %q", key, files), metadata)
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchExists reports whether a Fetch path resolves, without returning the
+// value.
+//
+// Path: ["__exists__", <fetch path>...], e.g. ["__exists__", "database",
+// "host"]. The result is {"exists": bool}. A missing root, file, or key, or a
+// key beneath a value navigation cannot descend into, yields false rather
+// than an error; files that fail to parse and ambiguous case-insensitive keys
+// still fail the call.
+func (s *FileProviderService) fetchExists(ctx context.Context, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a fetch path", controlExists)
+	}
+
+	exists, err := s.pathExists(args)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"exists": exists}, nil
+}
+
+// pathExists resolves path as Fetch would, through navigate so every
+// navigation option applies alike, and reports whether it names a value.
+func (s *FileProviderService) pathExists(path []string) (bool, error) {
+	target, err := s.resolveTarget(path)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if target.all {
+		return true, nil
+	}
+
+	data, err := s.loadFile(target.filePath)
+	if err != nil {
+		return false, parseStatus("failed to parse file", err)
+	}
+
+	current, err := s.navigate(data, s.scopedKeys(target.filePath, target.keys), path)
+	if status.Code(err) == codes.NotFound || hasReason(err, reasonNotNavigable) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// As in Fetch, a trailing "*" needs a map or a list to expand
+	if target.expand {
+		switch current.(type) {
+		case map[string]any, []any:
+			return true, nil
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Glob syntax for include/exclude patterns. Patterns are matched against
+// slash-separated paths relative to the scanned directory:
+//
+//	*       matches any sequence of characters within a single path segment
+//	?       matches any single character within a path segment
+//	[abc]   matches a character class, as in path.Match
+//	**      as a whole segment, matches zero or more path segments
+//
+// For example, "services/**/config.csl" matches services/config.csl,
+// services/api/config.csl and services/api/v1/config.csl, while
+// "services/*/config.csl" only matches one level below services.
+
+// validateGlob reports whether pattern is a well-formed glob.
+func validateGlob(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("glob pattern cannot be empty")
+	}
+
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "**" {
+			continue
+		}
+		if strings.Contains(segment, "**") {
+			return fmt.Errorf("invalid glob %q: '**' must be a whole path segment", pattern)
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchGlob reports whether name matches pattern. Patterns are assumed to
+// have been checked with validateGlob.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" and try every possible split point.
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
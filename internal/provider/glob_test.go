@@ -0,0 +1,41 @@
+package provider
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"services/**/config.csl", "services/config.csl", true},
+		{"services/**/config.csl", "services/api/config.csl", true},
+		{"services/**/config.csl", "services/api/v1/config.csl", true},
+		{"services/**/config.csl", "other/api/config.csl", false},
+		{"**/*.csl", "a/b/c/d.csl", true},
+		{"**", "anything/at/all.csl", true},
+		{"services/*/config.csl", "services/api/config.csl", true},
+		{"services/*/config.csl", "services/api/v1/config.csl", false},
+		{"*.csl", "nested/app.csl", false},
+		{"*.csl", "app.csl", true},
+		{"app?.csl", "app1.csl", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	for _, pattern := range []string{"", "a**/b", "[unclosed"} {
+		if err := validateGlob(pattern); err == nil {
+			t.Errorf("Expected validateGlob(%q) to fail", pattern)
+		}
+	}
+
+	if err := validateGlob("services/**/*.csl"); err != nil {
+		t.Errorf("Expected valid glob, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Deep health checks.
+//
+// Health is a cheap liveness check by default. A Health request carrying the
+// "deep: true" gRPC metadata header also parses every served file, in sorted
+// key order, and reports DEGRADED when any fails. The message is then a JSON
+// document for dashboards:
+//
+//	{"files": {"api": "ok", "broken": "error: ..."}, "checked": 2, "total": 2}
+//
+// Parses go through the parse cache, so repeated deep checks of unchanged
+// files cost a stat each. At most deepHealthMaxFiles files are checked per
+// call; "checked" falls short of "total" when the cap is reached.
+const (
+	deepHealthHeader   = "deep"
+	deepHealthMaxFiles = 1000
+)
+
+// deepHealthReport is the message of a deep Health response.
+type deepHealthReport struct {
+	Files   map[string]string `json:"files"`
+	Checked int               `json:"checked"`
+	Total   int               `json:"total"`
+}
+
+// deepHealth parses cslFiles, the served files as of the call, and reports
+// each one's status. It runs without s.mu, so a deep check of many files does
+// not hold up reloads or writes: cslFiles is only ever replaced, never
+// modified, under the write lock, and config's cache is safe for concurrent
+// use.
+func (s *FileProviderService) deepHealth(ctx context.Context, config *providerConfig, cslFiles map[string]string) (*providerv1.HealthResponse, error) {
+	names := make([]string, 0, len(cslFiles))
+	for name := range cslFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := deepHealthReport{Files: make(map[string]string), Total: len(names)}
+	if len(names) > deepHealthMaxFiles {
+		names = names[:deepHealthMaxFiles]
+	}
+
+	healthy := true
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		if _, _, err := s.parseFileWith(config, cslFiles[name]); err != nil {
+			report.Files[name] = fmt.Sprintf("error: %v", err)
+			healthy = false
+		} else {
+			report.Files[name] = "ok"
+		}
+		report.Checked++
+	}
+
+	message, err := json.Marshal(report)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode health report: %v", err)
+	}
+
+	healthStatus := providerv1.HealthResponse_STATUS_OK
+	if !healthy {
+		healthStatus = providerv1.HealthResponse_STATUS_DEGRADED
+	}
+	return &providerv1.HealthResponse{Status: healthStatus, Message: string(message)}, nil
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
+)
+
+// Import inlining.
+//
+// A top-level spread statement such as "@local:database" imports another
+// source. With inline_imports enabled, imports that reference a file served
+// by this provider (same alias) are resolved when the importing file is
+// fetched: the imported value is placed under the import's alias key (e.g.
+// "local"), deep-merged with other imports from the same alias in source
+// order. Imports that cannot be resolved (other aliases, unknown files or
+// paths) are listed under "__imports__" as {"alias", "path"} entries.
+//
+// Inlining is applied on top of the cached per-file parse results, so
+// changes to imported files are always reflected. Import cycles fail the
+// fetch with FailedPrecondition.
+const importsKey = "__imports__"
+
+// errImportCycle is returned when inlining imports revisits a file.
+var errImportCycle = errors.New("import cycle")
+
+// importRecord converts a spread statement into the entry recorded under
+// importsKey during conversion.
+func importRecord(ref *ast.ReferenceExpr) map[string]any {
+	path := make([]any, len(ref.Path))
+	for i, p := range ref.Path {
+		path[i] = p
+	}
+	return map[string]any{"alias": ref.Alias, "path": path}
+}
+
+// loadFile parses a file and, when inline_imports is enabled, inlines its
+// imports, then selects the active_variant (see selectVariant). The result
+// may share maps with the parse cache and must not be mutated.
+func (s *FileProviderService) loadFile(filePath string) (any, error) {
+	data, _, err := s.loadFileTimed(filePath)
+	return data, err
+}
+
+// loadFileTimed is loadFile, also reporting how the file was parsed (see
+// parseFileTimed).
+func (s *FileProviderService) loadFileTimed(filePath string) (any, parseTiming, error) {
+	data, timing, err := s.parseFileTimed(filePath)
+	if err == nil && s.config.converter.inlineImports {
+		data, err = s.inlineImports(data, []string{filePath})
+	}
+	if err != nil {
+		return nil, timing, err
+	}
+	data, err = s.config.selectVariant(filePath, data)
+	return data, timing, err
+}
+
+// inlineImports returns a copy of data with resolvable imports inlined.
+// chain holds the files being inlined, outermost first, for cycle detection.
+func (s *FileProviderService) inlineImports(data any, chain []string) (any, error) {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return data, nil
+	}
+	imports, ok := m[importsKey].([]any)
+	if !ok {
+		return data, nil
+	}
+
+	result := make(map[string]any, len(m))
+	for key, value := range m {
+		if key != importsKey {
+			result[key] = value
+		}
+	}
+
+	var unresolved []any
+	for _, entry := range imports {
+		record := entry.(map[string]any)
+		value, ok, err := s.resolveImport(record, chain)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			unresolved = append(unresolved, record)
+			continue
+		}
+
+		alias := record["alias"].(string)
+		existing, isMap := result[alias].(map[string]any)
+		imported, importedIsMap := value.(map[string]any)
+		if isMap && importedIsMap {
+			// Clone existing so the cached map is not mutated
+			merged := deepMergeMaps(make(map[string]any, len(existing)), existing)
+			result[alias] = deepMergeMaps(merged, imported)
+		} else {
+			result[alias] = value
+		}
+	}
+
+	if len(unresolved) > 0 {
+		result[importsKey] = unresolved
+	}
+	return result, nil
+}
+
+// resolveImport loads the value an import refers to, reporting false when it
+// is not served by this provider.
+func (s *FileProviderService) resolveImport(record map[string]any, chain []string) (any, bool, error) {
+	alias := record["alias"].(string)
+	rawPath := record["path"].([]any)
+	if alias != s.config.alias || len(rawPath) == 0 {
+		return nil, false, nil
+	}
+
+	path := make([]string, len(rawPath))
+	for i, p := range rawPath {
+		path[i] = p.(string)
+	}
+
+	key, keys := path[0], path[1:]
+	if s.config.roots != nil {
+		if len(path) < 2 {
+			return nil, false, nil
+		}
+		key, keys = rootKey(path[0], path[1]), path[2:]
+	}
+
+	filePath, exists := s.config.lookupFile(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	for i, visited := range chain {
+		if visited == filePath {
+			cycle := append(append([]string{}, chain[i:]...), filePath)
+			return nil, false, fmt.Errorf("%w: %s", errImportCycle, strings.Join(cycle, " -> "))
+		}
+	}
+
+	data, err := s.parseFile(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse imported file %q: %w", key, err)
+	}
+	data, err = s.inlineImports(data, append(chain, filePath))
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, ok := lookupPath(data, keys)
+	return value, ok, nil
+}
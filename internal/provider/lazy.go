@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Lazy scanning.
+//
+// With lazy_scan enabled, Init only checks that the configured directory (or
+// each root) exists; files are resolved on demand by statting
+// <dir>/<base>.csl (<dir>/<base> with keep_extension) when fetched. Only the
+// final ".csl" is assumed, so extension_trim "all" has no effect, and
+// duplicate base names cannot be detected. A file resolved through a symlink
+// must stay within the directory under jail_to_root, as when scanning.
+// Features that need the full file set (["*"], __recent__, __manifest__,
+// __where__) fail with FailedPrecondition.
+
+// errLazyScan is returned by whole-directory features in lazy mode.
+func errLazyScan(feature string) error {
+	return status.Errorf(codes.FailedPrecondition, "%s is not available with lazy_scan enabled", feature)
+}
+
+// lookupFile returns the absolute path of the file served under key (a base
+// name, or "root/base name" with roots), resolving it on demand in lazy mode.
+// A nested key is accepted in either key_style ("env/dev" or "env.dev"); the
+// key exactly as given is preferred (see keyConflict for when both exist).
+func (c *providerConfig) lookupFile(key string) (string, bool) {
+	if filePath, exists := c.cslFiles[key]; exists {
+		return filePath, true
+	}
+
+	prefix, relKey, dir, ok := c.splitKey(key)
+	if !ok {
+		return "", false
+	}
+
+	altKey, hasAlt := c.scan.alternateKey(relKey)
+	if hasAlt {
+		if filePath, exists := c.cslFiles[prefix+altKey]; exists {
+			return filePath, true
+		}
+	}
+
+	if !c.scan.lazy {
+		return "", false
+	}
+	if filePath, ok := c.lazyLookup(dir, relKey); ok {
+		return filePath, true
+	}
+	if hasAlt {
+		return c.lazyLookup(dir, altKey)
+	}
+	return "", false
+}
+
+// splitKey splits a file key into its root prefix ("" without roots), the key
+// relative to that root, and the root's directory.
+func (c *providerConfig) splitKey(key string) (prefix, relKey, dir string, ok bool) {
+	if c.roots == nil {
+		return "", key, c.directory, true
+	}
+	root, rest, ok := strings.Cut(key, "/")
+	if !ok {
+		return "", "", "", false
+	}
+	return rootKey(root, ""), rest, c.roots[root], true
+}
+
+// keyConflict reports the files a key names when it is genuinely ambiguous:
+// its path form and its dotted form (e.g. "env/dev" and "env.dev" for
+// env/dev.csl and env.dev.csl) are both enumerated files, whichever form was
+// requested. Files are reported relative to their directory, so errors do not
+// expose absolute paths. Lazy lookups are not checked.
+func (c *providerConfig) keyConflict(key string) ([]string, bool) {
+	prefix, relKey, dir, ok := c.splitKey(key)
+	if !ok {
+		return nil, false
+	}
+
+	seen := make(map[string]bool, 3)
+	var files []string
+	for _, form := range []string{relKey, strings.ReplaceAll(relKey, "/", "."), strings.ReplaceAll(relKey, ".", "/")} {
+		filePath, exists := c.cslFiles[prefix+form]
+		if !exists || seen[filePath] {
+			continue
+		}
+		seen[filePath] = true
+		files = append(files, c.relativeFile(dir, filePath))
+	}
+	if len(files) < 2 {
+		return nil, false
+	}
+
+	sort.Strings(files)
+	return files, true
+}
+
+// relativeFile returns filePath relative to dir (or to the overlay directory
+// it was enumerated from), falling back to its file name for a file listed
+// from elsewhere.
+func (c *providerConfig) relativeFile(dir, filePath string) string {
+	for _, root := range []string{dir, c.scan.overlayDir} {
+		if root == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(filePath)
+}
+
+// lazyLookup resolves relKey within dir on demand.
+func (c *providerConfig) lazyLookup(dir, relKey string) (string, bool) {
+	if !validLazyKey(relKey, c.scan.recursive) {
+		return "", false
+	}
+
+	relPath := relKey + cslExtension
+	switch {
+	case c.scan.isBlob(relKey):
+		relPath = relKey
+	case c.scan.keepExtension:
+		if !strings.HasSuffix(relKey, cslExtension) {
+			return "", false
+		}
+		relPath = relKey
+	}
+	if !c.scan.matches(relPath) {
+		return "", false
+	}
+
+	filePath := filepath.Join(dir, filepath.FromSlash(relPath))
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	if c.scan.jailToRoot && !withinRoot(dir, filePath) {
+		return "", false
+	}
+	return filePath, true
+}
+
+// validLazyKey reports whether key can name a file within the directory: no
+// empty, "." or ".." segments, and no subdirectories unless recursive.
+func validLazyKey(key string, recursive bool) bool {
+	if strings.ContainsRune(key, '\\') {
+		return false
+	}
+
+	segments := strings.Split(key, "/")
+	if len(segments) > 1 && !recursive {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// List limits.
+//
+// A consumer that only needs the first few elements of large lists sends the
+// "list-limit" gRPC metadata header with a non-negative element count. Every
+// list in the fetched value, at the target node and nested at any depth, is
+// cut to that many elements, and "__truncated__": true is added to the value
+// when any list was shortened. Maps are never truncated.
+const (
+	listLimitHeader = "list-limit"
+	truncatedKey    = "__truncated__"
+)
+
+// listLimit returns the request's list-limit and whether it was set. A value
+// that is not a non-negative integer fails with InvalidArgument.
+func listLimit(ctx context.Context) (int, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, nil
+	}
+
+	values := md.Get(listLimitHeader)
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+
+	limit, err := strconv.Atoi(values[0])
+	if err != nil || limit < 0 {
+		return 0, false, status.Errorf(codes.InvalidArgument, "%s must be a non-negative integer, got %q", listLimitHeader, values[0])
+	}
+	return limit, true, nil
+}
+
+// truncateLists returns a copy of v with every list cut to at most limit
+// elements, reporting whether anything was cut. v itself is never modified,
+// as it may be held by the parse cache.
+func truncateLists(v any, limit int) (any, bool) {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		truncated := false
+		for k, child := range val {
+			var cut bool
+			out[k], cut = truncateLists(child, limit)
+			truncated = truncated || cut
+		}
+		return out, truncated
+
+	case []any:
+		truncated := len(val) > limit
+		if truncated {
+			val = val[:limit]
+		}
+		out := make([]any, len(val))
+		for i, child := range val {
+			var cut bool
+			out[i], cut = truncateLists(child, limit)
+			truncated = truncated || cut
+		}
+		return out, truncated
+
+	default:
+		return v, false
+	}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchManifest returns a digest manifest of every served file.
+//
+// Path: ["__manifest__"]. The result is
+//
+//	{"files": [{"name", "path", "size", "modified", "sha256"}, ...], "digest": "..."}
+//
+// with files sorted by name. "path" is slash-separated and relative to the
+// configured directory (or the file's root), and "digest" is the SHA-256 over
+// every file's name and hash, so it changes whenever any file is added,
+// removed, renamed, or edited. Files are read on every call.
+func (s *FileProviderService) fetchManifest(ctx context.Context, args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s does not accept arguments", controlManifest)
+	}
+	if s.config.scan.lazy {
+		return nil, errLazyScan(controlManifest)
+	}
+
+	names := make([]string, 0, len(s.config.cslFiles))
+	for name := range s.config.cslFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	digest := sha256.New()
+	files := make([]any, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		filePath := s.config.cslFiles[name]
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to stat file %q: %v", name, err)
+		}
+
+		hash, err := fileHash(filePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to hash file %q: %v", name, err)
+		}
+
+		relPath, err := filepath.Rel(s.config.fileRoot(name), filePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to resolve path of file %q: %v", name, err)
+		}
+
+		digest.Write([]byte(name + "\x00" + hash + "\n"))
+		files = append(files, map[string]any{
+			"name":     name,
+			"path":     filepath.ToSlash(relPath),
+			"size":     info.Size(),
+			"modified": info.ModTime().UTC().Format(time.RFC3339Nano),
+			"sha256":   hash,
+		})
+	}
+
+	return map[string]any{
+		"files":  files,
+		"digest": hex.EncodeToString(digest.Sum(nil)),
+	}, nil
+}
+
+// fileRoot returns the directory a served file was enumerated from.
+func (c *providerConfig) fileRoot(name string) string {
+	if c.roots != nil {
+		root, _, _ := strings.Cut(name, "/")
+		return c.roots[root]
+	}
+	if c.fromOverlay(name) {
+		return c.scan.overlayDir
+	}
+	return c.directory
+}
+
+// fromOverlay reports whether the file served under name comes from
+// overlay_dir rather than base_dir.
+func (c *providerConfig) fromOverlay(name string) bool {
+	if c.scan.overlayDir == "" {
+		return false
+	}
+	filePath, ok := c.cslFiles[name]
+	return ok && strings.HasPrefix(filePath, c.scan.overlayDir+string(filepath.Separator))
+}
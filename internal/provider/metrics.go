@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// metricPrefix namespaces every metric written by WriteMetrics.
+const metricPrefix = "nomos_provider_file_"
+
+// metricsReset is the "__metrics__" argument that zeroes counters.
+const metricsReset = "reset"
+
+// serviceMetrics holds counters that survive re-initialization.
+type serviceMetrics struct {
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+
+	fetchCancelled        atomic.Uint64
+	fetchDeadlineExceeded atomic.Uint64
+}
+
+// recordContextEnd counts a fetch that failed because its context ended,
+// telling a cancelled caller apart from one whose deadline passed. Failures
+// unrelated to the context (e.g. NotFound) are not counted, even if the
+// context ended by the time they were returned.
+func (m *serviceMetrics) recordContextEnd(ctx context.Context, err error) {
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+	default:
+		if !errors.Is(err, ctxErr) {
+			return
+		}
+	}
+
+	switch ctxErr {
+	case context.Canceled:
+		m.fetchCancelled.Add(1)
+	case context.DeadlineExceeded:
+		m.fetchDeadlineExceeded.Add(1)
+	}
+}
+
+// metric is a single exported sample.
+type metric struct {
+	name  string
+	kind  string // "gauge" or "counter"
+	help  string
+	value float64
+}
+
+// metricSamples returns the current metric samples. With reset, counters are
+// zeroed as they are read; each is swapped atomically, so an increment made
+// by a concurrent fetch lands in either this sample or the next, never
+// neither. Gauges are not reset. The caller must hold s.mu (read or write).
+func (s *FileProviderService) metricSamples(reset bool) []metric {
+	var stats cacheStats
+	if s.config != nil && s.config.cache != nil {
+		stats = s.config.cache.stats(reset)
+	}
+
+	counter := func(c *atomic.Uint64) float64 {
+		if reset {
+			return float64(c.Swap(0))
+		}
+		return float64(c.Load())
+	}
+
+	return []metric{
+		{"cache_bytes", "gauge", "Estimated bytes held by the parse cache (on-disk size of cached files).", float64(stats.bytes)},
+		{"cache_entries", "gauge", "Number of parse results currently cached.", float64(stats.entries)},
+		{"cache_evictions_total", "counter", "Parse cache entries evicted to stay within cache_max_entries.", float64(stats.evictions)},
+		{"cache_hits_total", "counter", "File parses served from the parse cache.", counter(&s.metrics.cacheHits)},
+		{"cache_misses_total", "counter", "File parses not served from the parse cache.", counter(&s.metrics.cacheMisses)},
+		{"fetch_cancelled_total", "counter", "Fetches that failed because the caller cancelled the request.", counter(&s.metrics.fetchCancelled)},
+		{"fetch_deadline_exceeded_total", "counter", "Fetches that failed because the request deadline passed.", counter(&s.metrics.fetchDeadlineExceeded)},
+	}
+}
+
+// SnapshotMetrics returns the provider's metrics keyed by name, as served by
+// "__metrics__". With reset, counters are zeroed atomically as they are read,
+// so consecutive snapshots measure disjoint intervals; gauges are unaffected.
+func (s *FileProviderService) SnapshotMetrics(reset bool) map[string]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]float64)
+	for _, m := range s.metricSamples(reset) {
+		result[m.name] = m.value
+	}
+	return result
+}
+
+// WriteMetrics writes the provider's metrics in the Prometheus text
+// exposition format.
+func (s *FileProviderService) WriteMetrics(w io.Writer) error {
+	s.mu.RLock()
+	samples := s.metricSamples(false)
+	s.mu.RUnlock()
+
+	for _, m := range samples {
+		name := metricPrefix + m.name
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, m.help, name, m.kind, name, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchMetrics returns the provider's metrics keyed by name.
+//
+// Path: ["__metrics__"], or ["__metrics__", "reset"] to also zero the
+// counters (see SnapshotMetrics).
+func (s *FileProviderService) fetchMetrics(ctx context.Context, args []string) (any, error) {
+	reset := len(args) == 1 && args[0] == metricsReset
+	if len(args) != 0 && !reset {
+		return nil, status.Errorf(codes.InvalidArgument, "%s accepts only the argument %q", controlMetrics, metricsReset)
+	}
+
+	result := make(map[string]any)
+	for _, m := range s.metricSamples(reset) {
+		result[m.name] = m.value
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// valueWrapperKey holds a non-map Fetch result, which a Struct cannot carry
+// directly (see toProtoStruct).
+const valueWrapperKey = "value"
+
+// navigate descends into data following keys, one map lookup per key.
+//
+// Keys are matched literally: a key is never split on "." or any other
+// separator, so a map key such as "some.dotted.key" is addressed by passing it
+// as a single path segment. reqPath is the original request path, used only
+// for trace logging.
+//
+// With case_insensitive_keys enabled, keys are compared ignoring case; a key
+// that matches more than one entry (e.g. "host" and "Host") is rejected as
+// ambiguous rather than resolved arbitrarily.
+//
+// With inherit_parent_keys enabled, a map result also receives the scalar
+// keys of every enclosing section (see inheritKeys).
+//
+// With descend_value_wrapper enabled, a "value" key met at a node that is not
+// a map is consumed without moving, so a path extended through the synthetic
+// {"value": ...} wrapper of a scalar or list result still resolves. A real
+// "value" key in a map is looked up as usual.
+//
+// A reference met before the last key is followed into the file it targets
+// when follow_references is enabled (see followReference); otherwise
+// navigation stops with an error explaining why.
+func (s *FileProviderService) navigate(data any, keys []string, reqPath []string) (any, error) {
+	hops := 0
+	return s.navigateFrom(data, keys, reqPath, &hops)
+}
+
+// navigateFrom implements navigate. hops counts the references followed so
+// far across nested resolutions.
+func (s *FileProviderService) navigateFrom(data any, keys []string, reqPath []string, hops *int) (any, error) {
+	inherit := s.config != nil && s.config.inheritParentKeys
+	var inherited map[string]any
+
+	descendWrapper := s.config != nil && s.config.descendValueWrapper
+
+	current := data
+	for i, key := range keys {
+		if _, isMap := current.(map[string]any); !isMap && descendWrapper && key == valueWrapperKey {
+			s.tracef("fetch %q: step %d key %q: descending the value wrapper", reqPath, i+1, key)
+			continue
+		}
+
+		for {
+			ref, ok := referenceOf(current)
+			if !ok {
+				break
+			}
+			resolved, err := s.followReference(ref, key, i+1, reqPath, hops)
+			if err != nil {
+				return nil, err
+			}
+			current = resolved
+		}
+
+		m, ok := current.(map[string]any)
+		if !ok {
+			s.tracef("fetch %q: step %d key %q: node is %T, not a map", reqPath, i+1, key, current)
+			return nil, errNotNavigable("cannot navigate: element at index %d is not a map", i+1)
+		}
+
+		val, exists, err := s.lookupKey(m, key)
+		if err != nil {
+			s.tracef("fetch %q: step %d key %q: %v", reqPath, i+1, key, err)
+			return nil, err
+		}
+		if !exists {
+			s.tracef("fetch %q: step %d key %q: not found", reqPath, i+1, key)
+			return nil, status.Errorf(codes.NotFound, "key %q not found", key)
+		}
+
+		s.tracef("fetch %q: step %d key %q -> %T", reqPath, i+1, key, val)
+		// The file root is not a section, so its entries are never inherited
+		if inherit && i > 0 {
+			inherited = collectScalars(inherited, m)
+		}
+		current = val
+	}
+
+	if m, ok := current.(map[string]any); ok && len(inherited) > 0 {
+		return inheritKeys(m, inherited), nil
+	}
+	return current, nil
+}
+
+// collectScalars copies the scalar entries of section into inherited,
+// replacing entries from outer sections. Maps and lists are not scalars and
+// are never inherited.
+func collectScalars(inherited, section map[string]any) map[string]any {
+	for key, val := range section {
+		switch val.(type) {
+		case map[string]any, []any:
+			continue
+		}
+		if inherited == nil {
+			inherited = make(map[string]any)
+		}
+		inherited[key] = val
+	}
+	return inherited
+}
+
+// inheritKeys returns a copy of child with the inherited scalars merged
+// beneath it: a key the child defines, whatever its type, is never
+// overridden. child itself is not modified, as it may be held by the parse
+// cache.
+func inheritKeys(child, inherited map[string]any) map[string]any {
+	merged := make(map[string]any, len(child)+len(inherited))
+	for key, val := range inherited {
+		merged[key] = val
+	}
+	for key, val := range child {
+		merged[key] = val
+	}
+	return merged
+}
+
+// lookupKey returns the value stored under key in m, honoring
+// case_insensitive_keys.
+func (s *FileProviderService) lookupKey(m map[string]any, key string) (any, bool, error) {
+	if s.config == nil || !s.config.caseInsensitiveKeys {
+		val, exists := m[key]
+		return val, exists, nil
+	}
+
+	var matches []string
+	for candidate := range m {
+		if strings.EqualFold(candidate, key) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return m[matches[0]], true, nil
+	default:
+		sort.Strings(matches)
+		return nil, false, status.Errorf(codes.InvalidArgument,
+			"key %q is ambiguous: matches %q ignoring case", key, matches)
+	}
+}
+
+// scopedKeys returns keys prefixed with the configured fetch_root, for
+// navigating the data of filePath. Blobs have no such key and are navigated
+// from their payload.
+func (s *FileProviderService) scopedKeys(filePath string, keys []string) []string {
+	if len(s.config.fetchRoot) == 0 || !isCSLFile(filePath) {
+		return keys
+	}
+
+	scoped := make([]string, 0, len(s.config.fetchRoot)+len(keys))
+	scoped = append(scoped, s.config.fetchRoot...)
+	return append(scoped, keys...)
+}
+
+// lookupPath follows keys through nested maps, reporting false if any key is
+// missing or a non-map is reached before the last key. Keys are matched
+// exactly.
+func lookupPath(data any, keys []string) (any, bool) {
+	for _, key := range keys {
+		m, ok := data.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if data, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNavigate_DottedKey(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	data := map[string]any{
+		"app": map[string]any{
+			"some.dotted.key": "literal",
+			"some": map[string]any{
+				"dotted": map[string]any{"key": "nested"},
+			},
+		},
+	}
+
+	got, err := svc.navigate(data, []string{"app", "some.dotted.key"}, nil)
+	if err != nil {
+		t.Fatalf("navigate failed: %v", err)
+	}
+	if got != "literal" {
+		t.Errorf("Expected the literal dotted key's value, got %v", got)
+	}
+
+	got, err = svc.navigate(data, []string{"app", "some", "dotted", "key"}, nil)
+	if err != nil {
+		t.Fatalf("navigate failed: %v", err)
+	}
+	if got != "nested" {
+		t.Errorf("Expected the nested value, got %v", got)
+	}
+}
+
+func TestNavigate_DottedKeyNotSplit(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	data := map[string]any{
+		"some": map[string]any{"key": "nested"},
+	}
+
+	_, err := svc.navigate(data, []string{"some.key"}, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unsplit dotted segment, got %v", err)
+	}
+}
+
+func TestNavigate_CaseInsensitiveKeys(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	svc.config = &providerConfig{caseInsensitiveKeys: true}
+
+	data := map[string]any{
+		"database": map[string]any{"host": "localhost"},
+	}
+
+	got, err := svc.navigate(data, []string{"Database", "HOST"}, nil)
+	if err != nil {
+		t.Fatalf("navigate failed: %v", err)
+	}
+	if got != "localhost" {
+		t.Errorf("Expected %q, got %v", "localhost", got)
+	}
+
+	svc.config.caseInsensitiveKeys = false
+	if _, err := svc.navigate(data, []string{"Database", "HOST"}, nil); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound when case-sensitive, got %v", err)
+	}
+}
+
+func TestNavigate_CaseInsensitiveKeysAmbiguous(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	svc.config = &providerConfig{caseInsensitiveKeys: true}
+
+	data := map[string]any{
+		"database": map[string]any{"host": "a", "Host": "b"},
+	}
+
+	_, err := svc.navigate(data, []string{"database", "HOST"}, nil)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for ambiguous key, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguity error, got %v", err)
+	}
+}
+
+func TestNavigate_InheritParentKeys(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	svc.config = &providerConfig{inheritParentKeys: true}
+
+	data := map[string]any{
+		"region": "us-west-2",
+		"services": map[string]any{
+			"timeout": "30s",
+			"retries": "3",
+			"tags":    []any{"shared"},
+			"api": map[string]any{
+				"retries": "5",
+				"port":    "8080",
+			},
+		},
+	}
+
+	got, err := svc.navigate(data, []string{"services", "api"}, nil)
+	if err != nil {
+		t.Fatalf("navigate failed: %v", err)
+	}
+
+	want := map[string]any{"timeout": "30s", "retries": "5", "port": "8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	api := data["services"].(map[string]any)["api"].(map[string]any)
+	if _, ok := api["timeout"]; ok {
+		t.Error("Expected the source section to be left unmodified")
+	}
+
+	svc.config.inheritParentKeys = false
+	got, err = svc.navigate(data, []string{"services", "api"}, nil)
+	if err != nil {
+		t.Fatalf("navigate failed: %v", err)
+	}
+	if _, ok := got.(map[string]any)["timeout"]; ok {
+		t.Errorf("Expected no inherited keys when disabled, got %v", got)
+	}
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Values of the non_finite_numbers option.
+//
+// JSON has no representation for NaN or ±Inf, so a non-finite number (e.g. a
+// sum aggregate that overflows) would break canonical JSON and JSON-based
+// consumers. "error" fails the fetch naming the offending key; "string"
+// replaces each such number with the sentinel string "NaN", "+Inf" or "-Inf".
+const (
+	nonFiniteError  = "error"
+	nonFiniteString = "string"
+)
+
+// handleNonFinite applies non_finite_numbers to a fetched value before it is
+// converted to a Struct. data itself is never modified, as it may be held by
+// the parse cache.
+func (c *providerConfig) handleNonFinite(data any) (any, error) {
+	if c.nonFiniteNumbers == nonFiniteString {
+		return replaceNonFinite(data), nil
+	}
+
+	if path, n, found := findNonFinite(data, nil); found {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"value at %q is not a finite number (%s); set non_finite_numbers to %q to return it as a string",
+			strings.Join(path, "."), nonFiniteSentinel(n), nonFiniteString)
+	}
+	return data, nil
+}
+
+// findNonFinite returns the key path of the first non-finite number in v, in
+// sorted key order; list elements contribute their index.
+func findNonFinite(v any, path []string) ([]string, float64, bool) {
+	switch val := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if p, n, found := findNonFinite(val[key], append(path, key)); found {
+				return p, n, true
+			}
+		}
+	case []any:
+		for i, elem := range val {
+			if p, n, found := findNonFinite(elem, append(path, strconv.Itoa(i))); found {
+				return p, n, true
+			}
+		}
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return append([]string{}, path...), val, true
+		}
+	}
+	return nil, 0, false
+}
+
+// replaceNonFinite returns a copy of v with every non-finite number replaced
+// by its sentinel string.
+func replaceNonFinite(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, child := range val {
+			out[key] = replaceNonFinite(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			out[i] = replaceNonFinite(child)
+		}
+		return out
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return nonFiniteSentinel(val)
+		}
+	}
+	return v
+}
+
+// nonFiniteSentinel renders a non-finite number as "NaN", "+Inf" or "-Inf".
+func nonFiniteSentinel(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "+Inf"
+	case math.IsInf(n, -1):
+		return "-Inf"
+	default:
+		return "NaN"
+	}
+}
@@ -1,55 +1,312 @@
 package provider
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/autonomous-bits/nomos/libs/parser"
 	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
 )
 
-// parseCSLFile parses a .csl file and returns its data as a map[string]any.
-func parseCSLFile(filePath string) (any, error) {
-	// Parse the .csl file using the public parser API
-	tree, err := parser.ParseFile(filePath)
+// Reference formats accepted by the "ref_format" config key.
+const (
+	// refFormatString renders references as "reference:alias:path" strings.
+	refFormatString = "string"
+	// refFormatStruct renders references as {"__ref__": {...}} objects.
+	refFormatStruct = "struct"
+)
+
+// refKey is the reserved key wrapping a structured reference.
+const refKey = "__ref__"
+
+// Placements for top-level scalar entries accepted by the "root_entries"
+// config key.
+const (
+	// rootEntriesInline places top-level entries (e.g. `region: us-west-2`)
+	// at the root of the file's map, alongside sections.
+	rootEntriesInline = "inline"
+	// rootEntriesNested groups top-level entries under rootEntriesKey so the
+	// root only contains map sections.
+	rootEntriesNested = "nested"
+)
+
+// rootEntriesKey holds top-level entries when root_entries is "nested".
+const rootEntriesKey = "__root__"
+
+// Policies accepted by the "root_collision" config key, applied when a
+// top-level entry and a section share a name (root_entries "inline" only).
+const (
+	// rootCollisionError fails the conversion.
+	rootCollisionError = "error"
+	// rootCollisionSectionWins keeps the section and drops the entry.
+	rootCollisionSectionWins = "section_wins"
+	// rootCollisionEntryWins keeps the entry and drops the section.
+	rootCollisionEntryWins = "entry_wins"
+)
+
+// Default conversion limits, used when max_depth / max_nodes are not configured.
+const (
+	defaultMaxDepth = 128
+	defaultMaxNodes = 1 << 20
+)
+
+// errLimitExceeded is wrapped by conversion errors caused by a file exceeding
+// the configured depth or node limits.
+var errLimitExceeded = errors.New("conversion limit exceeded")
+
+// Parser parses .csl source into an AST. The provider uses libsParser; tests
+// substitute fakes that return crafted ASTs or errors.
+type Parser interface {
+	Parse(r io.Reader, filename string) (*ast.AST, error)
+}
+
+// libsParser is the default Parser, backed by libs/parser.
+type libsParser struct{}
+
+// Parse implements Parser.
+func (libsParser) Parse(r io.Reader, filename string) (*ast.AST, error) {
+	return parser.Parse(r, filename)
+}
+
+// converter turns parsed ASTs into plain Go values according to the
+// provider's conversion options. The zero value uses the default options.
+type converter struct {
+	// parser produces the AST of each file (libsParser when nil).
+	parser Parser
+
+	// refFormat selects how references are rendered (refFormatString when empty).
+	refFormat string
+
+	// refAliasPrefix is prepended to the alias of every rendered reference,
+	// so references from several providers can be told apart.
+	refAliasPrefix string
+
+	// rootEntries selects where top-level scalar entries are placed
+	// (rootEntriesInline when empty).
+	rootEntries string
+
+	// rootCollision selects what happens when an inline top-level entry and
+	// a section share a name (rootCollisionError when empty).
+	rootCollision string
+
+	// normalizeUnits converts scalar values with size or time suffixes
+	// (e.g. "512mb", "30s") into {"value", "unit"} objects.
+	normalizeUnits bool
+
+	// inlineImports records top-level spread statements under "__imports__"
+	// so they can be inlined at fetch time (see inlineImports).
+	inlineImports bool
+
+	// typedValues renders durations and timestamps as google.protobuf.Any
+	// JSON objects (see typedValue).
+	typedValues bool
+
+	// privateKeyPrefix, when set, omits every key starting with it, at any
+	// depth, so authors can keep private helper values (see
+	// strip_underscore_keys).
+	privateKeyPrefix string
+
+	// transforms rewrite string values at configured paths after
+	// conversion (see applyTransforms), in path order.
+	transforms []fieldTransform
+
+	// refTarget resolves a reference to the absolute path of the file that
+	// serves it, reporting false when the reference is not served by this
+	// provider. Only consulted for structured references; may be nil.
+	refTarget func(ref *ast.ReferenceExpr) (string, bool)
+
+	// maxDepth and maxNodes bound the nesting depth and total number of
+	// values converted per file (defaults apply when zero).
+	maxDepth int
+	maxNodes int
+}
+
+// conversion holds the per-file state of converting a single AST, so that a
+// converter can be shared by concurrent fetches.
+type conversion struct {
+	*converter
+
+	maxDepth int
+	maxNodes int
+	nodes    int
+
+	// lines is the file's source, consulted to tell quoted string literals
+	// from bare ones (the AST does not record the difference).
+	lines []string
+}
+
+// limits returns the effective depth and node limits.
+func (c *converter) limits() (maxDepth, maxNodes int) {
+	maxDepth, maxNodes = c.maxDepth, c.maxNodes
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+	if maxNodes <= 0 {
+		maxNodes = defaultMaxNodes
+	}
+	return maxDepth, maxNodes
+}
+
+// newConversion starts converting a single file with the given content.
+func (c *converter) newConversion(content []byte) *conversion {
+	maxDepth, maxNodes := c.limits()
+	return &conversion{
+		converter: c,
+		maxDepth:  maxDepth,
+		maxNodes:  maxNodes,
+		lines:     strings.Split(string(content), "\n"),
+	}
+}
+
+// quoted reports whether the string literal was written in quotes, judging
+// by the source character at the start of its span.
+func (cv *conversion) quoted(lit *ast.StringLiteral) bool {
+	line, col := lit.SourceSpan.StartLine-1, lit.SourceSpan.StartCol-1
+	if line < 0 || line >= len(cv.lines) || col < 0 || col >= len(cv.lines[line]) {
+		return false
+	}
+	switch cv.lines[line][col] {
+	case '"', '\'':
+		return true
+	}
+	return false
+}
+
+// enter accounts for one converted value at the given depth, failing once the
+// file exceeds the configured limits.
+func (cv *conversion) enter(depth int) error {
+	if depth > cv.maxDepth {
+		return fmt.Errorf("%w: nesting depth exceeds %d", errLimitExceeded, cv.maxDepth)
+	}
+
+	cv.nodes++
+	if cv.nodes > cv.maxNodes {
+		return fmt.Errorf("%w: more than %d values", errLimitExceeded, cv.maxNodes)
+	}
+
+	return nil
+}
+
+// parseCSL parses the content of a .csl file and returns its data as a
+// map[string]any. filePath is used in error messages and source spans.
+func (c *converter) parseCSL(content []byte, filePath string) (any, error) {
+	p := c.parser
+	if p == nil {
+		p = libsParser{}
+	}
+	tree, err := p.Parse(bytes.NewReader(content), filePath)
 	if err != nil {
+		if line, ok := documentSeparatorLine(content); ok {
+			return nil, fmt.Errorf("parse error: multiple documents per file are not supported (document separator %q on line %d): %w", documentSeparator, line, err)
+		}
 		return nil, fmt.Errorf("parse error: %w", err)
 	}
 
 	// Convert AST to data structure
-	data, err := astToData(tree)
+	data, err := c.newConversion(content).astToData(tree)
 	if err != nil {
 		return nil, fmt.Errorf("conversion error: %w", err)
 	}
+	if err := c.applyTransforms(data); err != nil {
+		return nil, fmt.Errorf("conversion error: %w", err)
+	}
 
 	return data, nil
 }
 
+// documentSeparator is the YAML-style separator users reach for when putting
+// several documents in one file. The CSL grammar has no such construct: each
+// file is exactly one document, so a file containing it fails to parse.
+const documentSeparator = "---"
+
+// documentSeparatorLine reports the 1-based line of the first document
+// separator in content, used to explain the resulting parse error.
+func documentSeparatorLine(content []byte) (int, bool) {
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == documentSeparator {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
 // astToData converts an AST to a data structure (map[string]any).
 // This is a simplified converter that handles the basic Nomos constructs.
-func astToData(tree *ast.AST) (map[string]any, error) {
+//
+// Top-level scalar entries are placed at the root of the result, or under
+// "__root__" when root_entries is "nested". When a name is declared more than
+// once at the top level as the same kind (entry or section), the later
+// declaration wins; an inline entry and a section sharing a name are resolved
+// by root_collision.
+func (cv *conversion) astToData(tree *ast.AST) (map[string]any, error) {
 	result := make(map[string]any)
+	// isEntry records, per name at the root, whether the current value came
+	// from a top-level entry (true) or a section (false)
+	isEntry := make(map[string]bool)
 
 	for _, stmt := range tree.Statements {
 		switch s := stmt.(type) {
 		case *ast.SectionDecl:
+			if cv.isPrivate(s.Name) {
+				continue
+			}
+			if err := cv.enter(1); err != nil {
+				return nil, fmt.Errorf("failed to convert section %q: %w", s.Name, err)
+			}
+
 			if s.Value != nil {
 				// Inline scalar value: region: "us-west-2"
-				val, err := convertExpr(s.Value)
+				val, err := cv.convertExpr(s.Value, 2)
 				if err != nil {
 					return nil, fmt.Errorf("failed to convert value for section %q: %w", s.Name, err)
 				}
-				result[s.Name] = val
+
+				if cv.rootEntries == rootEntriesNested {
+					rootEntries, _ := result[rootEntriesKey].(map[string]any)
+					if rootEntries == nil {
+						rootEntries = make(map[string]any)
+						result[rootEntriesKey] = rootEntries
+					}
+					rootEntries[s.Name] = val
+				} else {
+					keep, err := cv.resolveRootCollision(s.Name, isEntry, true)
+					if err != nil {
+						return nil, err
+					}
+					if keep {
+						result[s.Name] = val
+						isEntry[s.Name] = true
+					}
+				}
 			} else {
 				// Nested map: app: { ... }
-				sectionData, err := convertMapEntries(s.Entries)
+				sectionData, err := cv.convertMapEntries(s.Entries, 2)
 				if err != nil {
 					return nil, fmt.Errorf("failed to convert entries for section %q: %w", s.Name, err)
 				}
-				result[s.Name] = sectionData
+				keep, err := cv.resolveRootCollision(s.Name, isEntry, false)
+				if err != nil {
+					return nil, err
+				}
+				if keep {
+					result[s.Name] = sectionData
+					isEntry[s.Name] = false
+				}
+			}
+
+		case *ast.SpreadStmt:
+			// Imports are recorded for inlining (see inlineImports) and
+			// otherwise skipped
+			if cv.inlineImports {
+				imports, _ := result[importsKey].([]any)
+				result[importsKey] = append(imports, importRecord(s.Reference))
 			}
 
 		// Skip source declarations - these are metadata
-		case *ast.SourceDecl, *ast.SpreadStmt:
+		case *ast.SourceDecl:
 			continue
 		}
 	}
@@ -57,16 +314,45 @@ func astToData(tree *ast.AST) (map[string]any, error) {
 	return result, nil
 }
 
+// resolveRootCollision reports whether a top-level declaration of name (an
+// entry when entry is set, otherwise a section) should replace the value
+// already at the root. Declarations of the same kind always replace; an
+// entry and a section sharing a name follow root_collision.
+func (cv *conversion) resolveRootCollision(name string, isEntry map[string]bool, entry bool) (bool, error) {
+	existingIsEntry, exists := isEntry[name]
+	if !exists || existingIsEntry == entry {
+		return true, nil
+	}
+
+	switch cv.rootCollision {
+	case rootCollisionSectionWins:
+		return !entry, nil
+	case rootCollisionEntryWins:
+		return entry, nil
+	default:
+		return false, fmt.Errorf("top-level entry and section both named %q (set root_collision to section_wins or entry_wins, or root_entries to nested)", name)
+	}
+}
+
+// isPrivate reports whether key is omitted under strip_underscore_keys.
+func (c *converter) isPrivate(key string) bool {
+	return c.privateKeyPrefix != "" && strings.HasPrefix(key, c.privateKeyPrefix)
+}
+
 // convertMapEntries converts a list of MapEntry to a map[string]any.
-func convertMapEntries(entries []ast.MapEntry) (map[string]any, error) {
+// depth is the nesting depth of the entry values.
+func (cv *conversion) convertMapEntries(entries []ast.MapEntry, depth int) (map[string]any, error) {
 	result := make(map[string]any)
 	for _, entry := range entries {
 		if entry.Spread {
 			// Spread not supported in this simplified provider yet
 			continue
 		}
+		if cv.isPrivate(entry.Key) {
+			continue
+		}
 
-		val, err := convertExpr(entry.Value)
+		val, err := cv.convertExpr(entry.Value, depth)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert value for key %q: %w", entry.Key, err)
 		}
@@ -75,15 +361,24 @@ func convertMapEntries(entries []ast.MapEntry) (map[string]any, error) {
 	return result, nil
 }
 
-// convertExpr converts an AST expression to a Go value.
-func convertExpr(expr ast.Expr) (any, error) {
+// convertExpr converts an AST expression at the given nesting depth to a Go
+// value. Recursion is bounded by the conversion's depth limit.
+func (cv *conversion) convertExpr(expr ast.Expr, depth int) (any, error) {
+	if err := cv.enter(depth); err != nil {
+		return nil, err
+	}
+
 	switch e := expr.(type) {
 	case *ast.StringLiteral:
-		return e.Value, nil
+		return cv.scalar(e.Value, cv.quoted(e)), nil
 
 	case *ast.ReferenceExpr:
 		// References cannot be resolved in the provider - return a placeholder
 		// The compiler will resolve these
+		if cv.refFormat == refFormatStruct {
+			return cv.structuredReference(e), nil
+		}
+
 		pathStr := ""
 		for i, p := range e.Path {
 			if i > 0 {
@@ -91,12 +386,12 @@ func convertExpr(expr ast.Expr) (any, error) {
 			}
 			pathStr += p
 		}
-		return fmt.Sprintf("reference:%s:%s", e.Alias, pathStr), nil
+		return fmt.Sprintf("reference:%s%s:%s", cv.refAliasPrefix, e.Alias, pathStr), nil
 
 	case *ast.IdentExpr:
 		// Identifiers as values (e.g., boolean true/false or unquoted strings)
 		// For now, return as string
-		return e.Name, nil
+		return cv.scalar(e.Name, false), nil
 
 	case *ast.PathExpr:
 		// Path expressions as values
@@ -112,7 +407,7 @@ func convertExpr(expr ast.Expr) (any, error) {
 	case *ast.ListExpr:
 		list := make([]any, len(e.Elements))
 		for i, el := range e.Elements {
-			val, err := convertExpr(el)
+			val, err := cv.convertExpr(el, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -121,9 +416,48 @@ func convertExpr(expr ast.Expr) (any, error) {
 		return list, nil
 
 	case *ast.MapExpr:
-		return convertMapEntries(e.Entries)
+		return cv.convertMapEntries(e.Entries, depth+1)
 
 	default:
 		return nil, fmt.Errorf("unsupported expression type: %T", expr)
 	}
 }
+
+// scalar converts a string leaf value, applying unit normalization or typed
+// value wrapping when enabled. Quoted values are never unit-normalized, so
+// authors can keep a string such as "500m" as written.
+func (c *converter) scalar(value string, quoted bool) any {
+	if c.typedValues {
+		if typed, ok := typedValue(value); ok {
+			return typed
+		}
+	}
+	if c.normalizeUnits && !quoted {
+		if normalized, ok := normalizeUnit(value); ok {
+			return normalized
+		}
+	}
+	return value
+}
+
+// structuredReference renders a reference as {"__ref__": {"alias", "path"}},
+// adding "target_file" when the reference resolves to a file served by this
+// provider.
+func (c *converter) structuredReference(ref *ast.ReferenceExpr) map[string]any {
+	path := make([]any, len(ref.Path))
+	for i, p := range ref.Path {
+		path[i] = p
+	}
+
+	inner := map[string]any{
+		"alias": c.refAliasPrefix + ref.Alias,
+		"path":  path,
+	}
+	if c.refTarget != nil {
+		if target, ok := c.refTarget(ref); ok {
+			inner["target_file"] = target
+		}
+	}
+
+	return map[string]any{refKey: inner}
+}
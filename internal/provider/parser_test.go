@@ -0,0 +1,480 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// nestedCSL returns a section nested depth maps deep.
+func nestedCSL(depth int) string {
+	var b strings.Builder
+	b.WriteString("root:\n")
+	for i := 1; i < depth; i++ {
+		b.WriteString(strings.Repeat("  ", i))
+		b.WriteString("level:\n")
+	}
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString("leaf: value\n")
+	return b.String()
+}
+
+func TestFetch_MaxDepthExceeded(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"deep.csl": nestedCSL(10),
+	}, map[string]any{"max_depth": 4})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"deep"}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "nesting depth exceeds 4") {
+		t.Errorf("Expected depth limit in error, got: %v", err)
+	}
+}
+
+func TestFetch_MaxNodesExceeded(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"wide.csl": "app:\n  a: 1\n  b: 2\n  c: 3\n  d: 4\n",
+	}, map[string]any{"max_nodes": 3})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"wide"}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+}
+
+func TestFetch_WithinDepthLimit(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"deep.csl": nestedCSL(3),
+	}, map[string]any{"max_depth": 4})
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"deep"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+}
+
+func TestFetch_TopLevelEntries(t *testing.T) {
+	content := "region: us-west-2\nenvironment: prod\napp:\n  name: myapp\n"
+
+	t.Run("inline", func(t *testing.T) {
+		svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+
+		data := resp.Value.AsMap()
+		if data["region"] != "us-west-2" || data["environment"] != "prod" {
+			t.Errorf("Expected top-level entries at the root, got %v", data)
+		}
+		if app, ok := data["app"].(map[string]any); !ok || app["name"] != "myapp" {
+			t.Errorf("Expected app section alongside entries, got %v", data["app"])
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, map[string]any{"root_entries": "nested"})
+
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+
+		data := resp.Value.AsMap()
+		if _, ok := data["region"]; ok {
+			t.Errorf("Expected region to be moved under __root__, got %v", data)
+		}
+		root, ok := data["__root__"].(map[string]any)
+		if !ok || root["region"] != "us-west-2" || root["environment"] != "prod" {
+			t.Errorf("Expected top-level entries under __root__, got %v", data["__root__"])
+		}
+		if _, ok := data["app"].(map[string]any); !ok {
+			t.Errorf("Expected app section at the root, got %v", data["app"])
+		}
+	})
+}
+
+func TestFetch_SectionlessFile(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"answer.csl": "value: 42\n"}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"answer"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if data := resp.Value.AsMap(); !reflect.DeepEqual(data, map[string]any{"value": "42"}) {
+		t.Errorf("Expected the top-level entry, got %v", data)
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"answer", "value"}})
+	if err != nil {
+		t.Fatalf("Fetch of the entry failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "42" {
+		t.Errorf("Expected 42, got %v", got)
+	}
+}
+
+func TestFetch_RootCollision(t *testing.T) {
+	content := "app: legacy\napp:\n  name: myapp\n"
+
+	tests := []struct {
+		policy  any
+		want    any
+		wantErr string
+	}{
+		{nil, nil, `top-level entry and section both named "app"`},
+		{"error", nil, `top-level entry and section both named "app"`},
+		{"section_wins", map[string]any{"name": "myapp"}, ""},
+		{"entry_wins", "legacy", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.policy), func(t *testing.T) {
+			var config map[string]any
+			if tt.policy != nil {
+				config = map[string]any{"root_collision": tt.policy}
+			}
+			svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, config)
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if got := resp.Value.AsMap()["app"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected app %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFetch_NormalizeUnits(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"limits.csl": "limits:\n  memory: 512mb\n  timeout: 30s\n  idle: 5min\n  cpu: 500m\n  quoted: '30s'\n  region: us-west-2\n",
+	}, map[string]any{"normalize_units": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"limits", "limits"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data := resp.Value.AsMap()
+
+	memory, ok := data["memory"].(map[string]any)
+	if !ok || memory["value"] != float64(536870912) || memory["unit"] != "bytes" {
+		t.Errorf("Expected memory normalized to 536870912 bytes, got %v", data["memory"])
+	}
+
+	timeout, ok := data["timeout"].(map[string]any)
+	if !ok || timeout["value"] != float64(30) || timeout["unit"] != "seconds" {
+		t.Errorf("Expected timeout normalized to 30 seconds, got %v", data["timeout"])
+	}
+
+	idle, ok := data["idle"].(map[string]any)
+	if !ok || idle["value"] != float64(300) || idle["unit"] != "seconds" {
+		t.Errorf("Expected idle normalized to 300 seconds, got %v", data["idle"])
+	}
+
+	if data["cpu"] != "500m" {
+		t.Errorf("Expected millicores untouched, got %v", data["cpu"])
+	}
+
+	if data["quoted"] != "30s" {
+		t.Errorf("Expected quoted value untouched, got %v", data["quoted"])
+	}
+
+	if data["region"] != "us-west-2" {
+		t.Errorf("Expected plain string untouched, got %v", data["region"])
+	}
+}
+
+func TestNormalizeUnit_LeavesPlainStrings(t *testing.T) {
+	for _, value := range []string{"us-west-2", "hello", "5432", "10 mb", "-5s", "3parsecs", "500m"} {
+		if got, ok := normalizeUnit(value); ok {
+			t.Errorf("Expected %q to be left untouched, got %v", value, got)
+		}
+	}
+}
+
+func TestFetch_TypedValues(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"app.csl": "app:\n  timeout: 1h30m\n  released: '2024-01-02T03:04:05Z'\n  region: us-west-2\n",
+	}, map[string]any{"typed_values": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	// unpackAny decodes a field of the response as google.protobuf.Any.
+	unpackAny := func(key string, into proto.Message) {
+		t.Helper()
+		encoded, err := protojson.Marshal(resp.Value.Fields[key])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wrapped anypb.Any
+		if err := protojson.Unmarshal(encoded, &wrapped); err != nil {
+			t.Fatalf("%s is not an Any: %v (%s)", key, err, encoded)
+		}
+		if err := wrapped.UnmarshalTo(into); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+	}
+
+	var timeout durationpb.Duration
+	unpackAny("timeout", &timeout)
+	if got := timeout.AsDuration(); got != 90*time.Minute {
+		t.Errorf("Expected timeout 1h30m, got %v", got)
+	}
+
+	var released timestamppb.Timestamp
+	unpackAny("released", &released)
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !released.AsTime().Equal(want) {
+		t.Errorf("Expected released %v, got %v", want, released.AsTime())
+	}
+
+	if got := resp.Value.AsMap()["region"]; got != "us-west-2" {
+		t.Errorf("Expected plain string untouched, got %v", got)
+	}
+}
+
+func TestFetch_MultipleDocumentsRejected(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"multi.csl": "a:\n  x: 1\n---\nb:\n  y: 2\n",
+	}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"multi"}})
+	if err == nil {
+		t.Fatal("Expected multi-document file to fail")
+	}
+	if !strings.Contains(err.Error(), "multiple documents per file are not supported") || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected a clear multi-document error naming line 3, got %v", err)
+	}
+}
+
+func TestFetch_InlineImports(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"app.csl":      "@test:database\n@other:network\napp:\n  name: web\n",
+		"database.csl": "db:\n  host: localhost\n",
+	}, map[string]any{"inline_imports": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data := resp.Value.AsMap()
+
+	imported, ok := data["test"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected database inlined under alias key %q, got %v", "test", data)
+	}
+	if db, _ := imported["db"].(map[string]any); db["host"] != "localhost" {
+		t.Errorf("Expected inlined db.host 'localhost', got %v", imported)
+	}
+
+	unresolved, _ := data[importsKey].([]any)
+	if len(unresolved) != 1 || unresolved[0].(map[string]any)["alias"] != "other" {
+		t.Errorf("Expected the @other import listed under %s, got %v", importsKey, data[importsKey])
+	}
+}
+
+func TestFetch_InlineImportsCycle(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"a.csl": "@test:b\nname: a\n",
+		"b.csl": "@test:a\nname: b\n",
+	}, map[string]any{"inline_imports": true})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"a"}})
+	if status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), "import cycle") {
+		t.Errorf("Expected FailedPrecondition import cycle, got %v", err)
+	}
+}
+
+func TestFetch_Transforms(t *testing.T) {
+	content := "database:\n  password: c2VjcmV0\n  user: \"  admin  \"\n  host: \"  db.local  \"\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, map[string]any{
+		"transforms": map[string]any{
+			"database.password": "base64decode",
+			"database.user":     "trim",
+			"database.missing":  "lower",
+		},
+	})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if data["password"] != "secret" {
+		t.Errorf("Expected base64-decoded password, got %q", data["password"])
+	}
+	if data["user"] != "admin" {
+		t.Errorf("Expected trimmed user, got %q", data["user"])
+	}
+	if data["host"] != "  db.local  " {
+		t.Errorf("Expected untransformed host, got %q", data["host"])
+	}
+}
+
+func TestFetch_TransformInvalidBase64(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "database:\n  password: \"***\"\n"}, map[string]any{
+		"transforms": map[string]any{"database.password": "base64decode"},
+	})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database"}})
+	if err == nil || !strings.Contains(err.Error(), `transform "base64decode" at "database.password"`) {
+		t.Errorf("Expected a transform error naming the path, got %v", err)
+	}
+}
+
+// The parser has no type annotation syntax, so an annotated-looking value is
+// kept verbatim as a string rather than typed or dropped.
+func TestFetch_TypeAnnotationIsPlainString(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "db:\n  port: int = 5432\n"}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "db", "port"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "int = 5432" {
+		t.Errorf("Expected the value verbatim, got %v", got)
+	}
+}
+
+// fakeParser is a Parser returning a fixed AST or error.
+type fakeParser struct {
+	tree *ast.AST
+	err  error
+}
+
+func (p fakeParser) Parse(r io.Reader, filename string) (*ast.AST, error) {
+	return p.tree, p.err
+}
+
+func TestParseCSL_FakeParserConversion(t *testing.T) {
+	tree := &ast.AST{Statements: []ast.Stmt{
+		&ast.SectionDecl{Name: "app", Entries: []ast.MapEntry{
+			{Key: "path", Value: &ast.PathExpr{Components: []string{"a", "b", "c"}}},
+			{Key: "ident", Value: &ast.IdentExpr{Name: "enabled"}},
+			{Key: "list", Value: &ast.ListExpr{Elements: []ast.Expr{&ast.StringLiteral{Value: "x"}}}},
+		}},
+		&ast.SourceDecl{Alias: "other", Type: "file"},
+	}}
+
+	data, err := (&converter{parser: fakeParser{tree: tree}}).parseCSL(nil, "fake.csl")
+	if err != nil {
+		t.Fatalf("parseCSL failed: %v", err)
+	}
+
+	want := map[string]any{"app": map[string]any{
+		"path":  "a.b.c",
+		"ident": "enabled",
+		"list":  []any{"x"},
+	}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Expected %v, got %v", want, data)
+	}
+}
+
+func TestParseCSL_FakeParserUnsupportedExpression(t *testing.T) {
+	tree := &ast.AST{Statements: []ast.Stmt{
+		&ast.SectionDecl{Name: "app", Entries: []ast.MapEntry{
+			{Key: "secret", Value: &ast.MarkedExpr{Expr: &ast.StringLiteral{Value: "x"}}},
+		}},
+	}}
+
+	_, err := (&converter{parser: fakeParser{tree: tree}}).parseCSL(nil, "fake.csl")
+	if err == nil || !strings.Contains(err.Error(), "unsupported expression type: *ast.MarkedExpr") {
+		t.Errorf("Expected an unsupported expression error, got %v", err)
+	}
+}
+
+func TestFetch_FakeParserErrorPropagates(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+	svc.parser = fakeParser{err: errors.New("crafted failure")}
+	svc.config.converter.parser = svc.parser
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+	if status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "parse error: crafted failure") {
+		t.Errorf("Expected Internal wrapping the parser error, got %v", err)
+	}
+}
+
+func TestParseCSL_StripUnderscoreKeys(t *testing.T) {
+	content := "_scaffold:\n  base: x\napp:\n  name: test\n  _helper: y\n  db:\n    host: h\n    _secret: z\n"
+
+	tests := []struct {
+		name      string
+		converter converter
+		want      map[string]any
+	}{
+		{
+			name:      "disabled",
+			converter: converter{},
+			want: map[string]any{
+				"_scaffold": map[string]any{"base": "x"},
+				"app": map[string]any{
+					"name":    "test",
+					"_helper": "y",
+					"db":      map[string]any{"host": "h", "_secret": "z"},
+				},
+			},
+		},
+		{
+			name:      "underscore prefix",
+			converter: converter{privateKeyPrefix: "_"},
+			want: map[string]any{
+				"app": map[string]any{
+					"name": "test",
+					"db":   map[string]any{"host": "h"},
+				},
+			},
+		},
+		{
+			name:      "custom prefix",
+			converter: converter{privateKeyPrefix: "_sc"},
+			want: map[string]any{
+				"app": map[string]any{
+					"name":    "test",
+					"_helper": "y",
+					"db":      map[string]any{"host": "h", "_secret": "z"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.converter.parseCSL([]byte(content), "test.csl")
+			if err != nil {
+				t.Fatalf("parseCSL failed: %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, data)
+			}
+		})
+	}
+}
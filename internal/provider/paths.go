@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pathsMaxDepth bounds how many keys deep __paths__ walks, so a deeply nested
+// file cannot produce an unbounded listing.
+const pathsMaxDepth = 32
+
+// fetchPaths lists every addressable path inside a file, for autocomplete.
+//
+// Path: ["__paths__", <fetch path>...], e.g. ["__paths__", "database"] or
+// ["__paths__", "database", "primary"]. The result holds sorted dotted paths
+// relative to the file (including any keys given), beneath fetch_root:
+// "leaves" are non-map values (lists included) and "maps" are intermediate
+// maps. Nothing more than pathsMaxDepth keys below the fetched node is
+// listed; "truncated" reports whether anything was cut. Keys that contain
+// "." make dotted paths ambiguous, so clients needing exact keys should
+// navigate with Fetch.
+func (s *FileProviderService) fetchPaths(ctx context.Context, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a file path", controlPaths)
+	}
+
+	target, err := s.resolveTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	if target.all {
+		return nil, status.Errorf(codes.InvalidArgument, `%s does not support path ["*"]`, controlPaths)
+	}
+
+	data, err := s.loadFile(target.filePath)
+	if err != nil {
+		return nil, parseStatus("failed to parse file", err)
+	}
+	data, err = s.navigate(data, s.scopedKeys(target.filePath, target.keys), args)
+	if err != nil {
+		return nil, err
+	}
+
+	w := pathWalker{}
+	w.walk(data, target.keys, 0)
+	sort.Strings(w.leaves)
+	sort.Strings(w.maps)
+
+	return map[string]any{
+		"leaves":    stringsToAny(w.leaves),
+		"maps":      stringsToAny(w.maps),
+		"truncated": w.truncated,
+	}, nil
+}
+
+// pathWalker collects dotted paths of a converted value.
+type pathWalker struct {
+	leaves    []string
+	maps      []string
+	truncated bool
+}
+
+// walk records v, found at prefix, and its descendants. depth counts the
+// keys walked below the fetched node.
+func (w *pathWalker) walk(v any, prefix []string, depth int) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		if len(prefix) > 0 {
+			w.leaves = append(w.leaves, strings.Join(prefix, "."))
+		}
+		return
+	}
+
+	if len(prefix) > 0 {
+		w.maps = append(w.maps, strings.Join(prefix, "."))
+	}
+	if depth >= pathsMaxDepth {
+		w.truncated = w.truncated || len(m) > 0
+		return
+	}
+
+	for key, child := range m {
+		w.walk(child, append(prefix[:len(prefix):len(prefix)], key), depth+1)
+	}
+}
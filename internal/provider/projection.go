@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Projections.
+//
+// A consumer that wants a few fields of the fetched node reshaped sends the
+// "projection" gRPC metadata header with a spec such as
+// "{host: database.host, port: database.port}". Each entry names an output
+// key and a dot-separated path evaluated against the navigated node, with the
+// same rules as Fetch path segments (references are followed when
+// follow_references is enabled). The result is a flat map of the projected
+// values; a path that does not resolve fails the fetch. The braces are
+// optional, and a map key containing "." cannot be addressed.
+const projectionHeader = "projection"
+
+// projectionField is one "name: path" entry of a projection spec.
+type projectionField struct {
+	name string
+	keys []string
+}
+
+// requestedProjection returns the request's projection and whether it was
+// set. A malformed spec fails with InvalidArgument.
+func requestedProjection(ctx context.Context) ([]projectionField, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, false, nil
+	}
+
+	values := md.Get(projectionHeader)
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+
+	fields, err := parseProjection(values[0])
+	if err != nil {
+		return nil, false, status.Errorf(codes.InvalidArgument, "%s: %v", projectionHeader, err)
+	}
+	return fields, true, nil
+}
+
+// parseProjection parses a spec of comma-separated "name: path" entries,
+// optionally enclosed in braces.
+func parseProjection(spec string) ([]projectionField, error) {
+	body := strings.TrimSpace(spec)
+	if strings.HasPrefix(body, "{") {
+		if !strings.HasSuffix(body, "}") {
+			return nil, fmt.Errorf("unbalanced braces in %q", spec)
+		}
+		body = strings.TrimSpace(body[1 : len(body)-1])
+	}
+	if body == "" {
+		return nil, fmt.Errorf("empty spec %q", spec)
+	}
+
+	var fields []projectionField
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(body, ",") {
+		name, source, ok := strings.Cut(entry, ":")
+		name, source = strings.TrimSpace(name), strings.TrimSpace(source)
+		if !ok || name == "" || source == "" {
+			return nil, fmt.Errorf("entry %q must have the form name: path", strings.TrimSpace(entry))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate field %q", name)
+		}
+		seen[name] = true
+
+		keys := strings.Split(source, ".")
+		for _, key := range keys {
+			if key == "" {
+				return nil, fmt.Errorf("field %q has an empty segment in path %q", name, source)
+			}
+		}
+		fields = append(fields, projectionField{name: name, keys: keys})
+	}
+	return fields, nil
+}
+
+// project evaluates fields against data, returning a new map of the projected
+// values. data itself is not modified, as it may be held by the parse cache.
+func (s *FileProviderService) project(data any, fields []projectionField, reqPath []string) (map[string]any, error) {
+	out := make(map[string]any, len(fields))
+	for _, field := range fields {
+		val, err := s.navigate(data, field.keys, reqPath)
+		if err != nil {
+			st := status.Convert(err)
+			return nil, status.Errorf(st.Code(), "projection field %q: %s", field.name, st.Message())
+		}
+		out[field.name] = val
+	}
+	return out, nil
+}
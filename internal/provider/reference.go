@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxReferenceHops bounds how many references a single navigation follows,
+// so reference cycles fail instead of looping.
+const maxReferenceHops = 32
+
+// reference is a converted reference placeholder, in either ref_format.
+type reference struct {
+	alias string
+	path  []string
+}
+
+// String renders the reference as written in source ("@alias:a.b").
+func (r reference) String() string {
+	return "@" + r.alias + ":" + strings.Join(r.path, ".")
+}
+
+// structured renders the reference as {"__ref__": {"alias", "path"}}, the
+// ref_format "struct" form.
+func (r reference) structured() map[string]any {
+	path := make([]any, len(r.path))
+	for i, p := range r.path {
+		path[i] = p
+	}
+	return map[string]any{refKey: map[string]any{"alias": r.alias, "path": path}}
+}
+
+// referenceOf reports whether v is a converted reference: a
+// "reference:alias:path" string or a {"__ref__": {...}} object.
+func referenceOf(v any) (reference, bool) {
+	switch val := v.(type) {
+	case string:
+		rest, ok := strings.CutPrefix(val, "reference:")
+		if !ok {
+			return reference{}, false
+		}
+		alias, path, ok := strings.Cut(rest, ":")
+		if !ok || alias == "" || path == "" {
+			return reference{}, false
+		}
+		return reference{alias: alias, path: strings.Split(path, ".")}, true
+
+	case map[string]any:
+		inner, ok := val[refKey].(map[string]any)
+		if !ok || len(val) != 1 {
+			return reference{}, false
+		}
+		alias, _ := inner["alias"].(string)
+		segments, _ := inner["path"].([]any)
+		path := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			str, ok := segment.(string)
+			if !ok {
+				return reference{}, false
+			}
+			path = append(path, str)
+		}
+		if alias == "" || len(path) == 0 {
+			return reference{}, false
+		}
+		return reference{alias: alias, path: path}, true
+	}
+
+	return reference{}, false
+}
+
+// followReference resolves ref, met at index while navigating to key, to the
+// value it targets so navigation can continue beneath it.
+//
+// Only references to this provider's own files are followed, and only with
+// follow_references enabled. The reference path is resolved as a Fetch of
+// the same path would be, including fetch_root.
+func (s *FileProviderService) followReference(ref reference, key string, index int, reqPath []string, hops *int) (any, error) {
+	if s.config == nil || !s.config.followReferences {
+		s.tracef("fetch %q: step %d key %q: blocked by reference %s", reqPath, index, key, ref)
+		return nil, errNotNavigable(
+			"cannot navigate to %q: element at index %d is a reference to %s; set follow_references: true to descend into references to this provider's files",
+			key, index, ref)
+	}
+
+	// Rendered aliases carry ref_alias_prefix; the source alias does not
+	alias, prefixed := strings.CutPrefix(ref.alias, s.config.converter.refAliasPrefix)
+	filePath, refKeys, ok := s.config.referenceFile(alias, ref.path)
+	if !prefixed || !ok {
+		s.tracef("fetch %q: step %d key %q: reference %s is not served by this provider", reqPath, index, key, ref)
+		return nil, errNotNavigable(
+			"cannot navigate to %q: element at index %d is a reference to %s, which is not served by this provider",
+			key, index, ref)
+	}
+
+	*hops++
+	if *hops > maxReferenceHops {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"cannot navigate to %q: followed more than %d references (reference cycle?)", key, maxReferenceHops)
+	}
+
+	s.tracef("fetch %q: step %d key %q: following reference %s to %s", reqPath, index, key, ref, filePath)
+	data, err := s.loadFile(filePath)
+	if err != nil {
+		return nil, parseStatus("failed to parse referenced file", err)
+	}
+	return s.navigateFrom(data, s.scopedKeys(filePath, refKeys), reqPath, hops)
+}
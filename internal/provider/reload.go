@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+)
+
+// Reload re-enumerates the configured directory (or roots) and flushes the
+// parse cache, so files added, removed, or renamed since Init become visible
+// without re-initializing. The rest of the configuration is kept.
+//
+// Reload holds the exclusive lock, so in-flight fetches complete first and
+// later fetches observe the new file set. On error the previous file set is
+// kept.
+func (s *FileProviderService) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config == nil || !s.config.initialized {
+		return errNotInitialized()
+	}
+
+	cslFiles, err := s.reenumerate(ctx, s.config)
+	if err != nil {
+		return err
+	}
+
+	s.config.cslFiles = cslFiles
+	if s.config.cache != nil {
+		s.config.cache.purge()
+	}
+
+	log.Printf("Reloaded provider: alias=%q files=%d", s.config.alias, len(cslFiles))
+	return nil
+}
+
+// reenumerate enumerates config's directory (or roots) again, bounded by
+// init_timeout. It only reads settings fixed at Init, so the caller need not
+// hold s.mu.
+func (s *FileProviderService) reenumerate(ctx context.Context, config *providerConfig) (map[string]string, error) {
+	if config.initTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.initTimeout)
+		defer cancel()
+	}
+
+	if config.roots == nil {
+		cslFiles, err := s.enumerateCSLFiles(ctx, config.directory, config.scan)
+		if err != nil {
+			return nil, enumerationError("failed to enumerate .csl files", err)
+		}
+		return cslFiles, nil
+	}
+
+	cslFiles := make(map[string]string)
+	for name, dirPath := range config.roots {
+		rootFiles, err := s.enumerateCSLFiles(ctx, dirPath, config.scan)
+		if err != nil {
+			return nil, enumerationError(fmt.Sprintf("failed to enumerate .csl files for root %q", name), err)
+		}
+		for baseName, filePath := range rootFiles {
+			cslFiles[rootKey(name, baseName)] = filePath
+		}
+	}
+	return cslFiles, nil
+}
+
+// startPolling re-enumerates config's files every reload_interval until
+// stopPolling is called, for filesystems where SIGHUP or change events are
+// not available. The caller must hold s.mu.
+func (s *FileProviderService) startPolling(config *providerConfig) {
+	s.stopPolling()
+	if config.reloadInterval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.pollStop = stop
+
+	go func() {
+		ticker := time.NewTicker(config.reloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.poll(config)
+			}
+		}
+	}()
+}
+
+// stopPolling stops the reload_interval poller, if any. The caller must hold
+// s.mu.
+func (s *FileProviderService) stopPolling() {
+	if s.pollStop != nil {
+		close(s.pollStop)
+		s.pollStop = nil
+	}
+}
+
+// poll re-enumerates the files of config if it is still the active
+// configuration. Unlike Reload it keeps the parse cache, whose entries are
+// validated against each file's modtime and size on use; only entries of
+// files that are no longer served are dropped.
+//
+// Enumeration runs without s.mu, so a slow filesystem does not stall
+// fetches; the write lock is only taken to swap the new file set in.
+func (s *FileProviderService) poll(config *providerConfig) {
+	s.mu.RLock()
+	active := s.config == config
+	s.mu.RUnlock()
+	if !active {
+		return
+	}
+
+	cslFiles, err := s.reenumerate(context.Background(), config)
+	if err != nil {
+		log.Printf("Reload poll failed: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Re-initialized or shut down while enumerating
+	if s.config != config {
+		return
+	}
+	if maps.Equal(cslFiles, config.cslFiles) {
+		return
+	}
+
+	if config.cache != nil {
+		served := make(map[string]bool, len(cslFiles))
+		for _, filePath := range cslFiles {
+			served[filePath] = true
+		}
+		for _, filePath := range config.cslFiles {
+			if !served[filePath] {
+				config.cache.forget(filePath)
+			}
+		}
+	}
+	config.cslFiles = cslFiles
+
+	log.Printf("Reloaded provider after poll: alias=%q files=%d", config.alias, len(cslFiles))
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Samples.
+//
+// Consumers that property-test against a file's schema rather than its data
+// send the "sample: true" gRPC metadata header. The fetched value keeps its
+// structure (every map key and list element) but each scalar is replaced by
+// the zero value of its detected type: false for "true"/"false", 0 for
+// numbers, and "" for every other string, references included. The same file
+// always yields the same sample.
+const sampleHeader = "sample"
+
+// boolHeader reports whether the request carries header set to true. A value
+// that is not a boolean fails with InvalidArgument.
+func boolHeader(ctx context.Context, header string) (bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	values := md.Get(header)
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	set, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "%s must be true or false, got %q", header, values[0])
+	}
+	return set, nil
+}
+
+// sampleValue returns a copy of v with every scalar replaced by its zero
+// value. v itself is never modified, as it may be held by the parse cache.
+func sampleValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			out[k] = sampleValue(child)
+		}
+		// Keep the type URL of a typed_values Any, which names the type
+		// rather than holding data
+		if typeURL, ok := val["@type"]; ok {
+			out["@type"] = typeURL
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			out[i] = sampleValue(child)
+		}
+		return out
+
+	case string:
+		return zeroOf(val)
+
+	case bool:
+		return false
+
+	case float64, int, int64:
+		return float64(0)
+
+	default:
+		return nil
+	}
+}
+
+// zeroOf returns the zero value of the type a converted scalar string holds.
+func zeroOf(s string) any {
+	switch scalarType(s) {
+	case scalarBool:
+		return false
+	case scalarNumber:
+		return float64(0)
+	default:
+		return ""
+	}
+}
+
+// Type names detected in converted scalar strings.
+const (
+	scalarBool   = "bool"
+	scalarNumber = "number"
+	scalarString = "string"
+)
+
+// scalarType returns the type a converted scalar string holds: scalarBool for
+// "true"/"false", scalarNumber for a finite number, otherwise scalarString.
+func scalarType(s string) string {
+	if s == "true" || s == "false" {
+		return scalarBool
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return scalarNumber
+	}
+	return scalarString
+}
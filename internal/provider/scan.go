@@ -0,0 +1,456 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scanOptions controls how a directory is enumerated for .csl files.
+type scanOptions struct {
+	// recursive descends into subdirectories. Files in subdirectories are
+	// keyed by their slash-separated relative path without the extension
+	// (e.g. "env/dev" for env/dev.csl).
+	recursive bool
+
+	// lazy skips enumeration entirely; files are resolved on demand (see
+	// lookupFile).
+	lazy bool
+
+	// include and exclude are glob patterns matched against the
+	// slash-separated path relative to the scanned directory (see matchGlob).
+	// A file is enumerated if it matches any include pattern (or include is
+	// empty) and no exclude pattern.
+	include []string
+	exclude []string
+
+	// extensionTrim selects how the base name is derived from a file name:
+	// extensionTrimLast removes only the final ".csl" ("my.csl.csl" ->
+	// "my.csl"); extensionTrimAll removes every trailing ".csl" ("my.csl.csl"
+	// -> "my"). Other dotted segments are always kept ("data.v1.csl" ->
+	// "data.v1").
+	extensionTrim string
+
+	// keepExtension keys .csl files by their full relative path, extension
+	// included ("config.csl", "env/dev.csl"), for tools that treat file names
+	// opaquely. extensionTrim does not apply.
+	keepExtension bool
+
+	// fileList, when set, replaces scanning: exactly these files (absolute
+	// or relative to the directory) are registered, and every one must
+	// exist (see listFiles). Recursion and include/exclude do not apply.
+	fileList []string
+
+	// onDuplicate selects what happens when several files map to the same
+	// base name: onDuplicateError fails, onDuplicateFirstWins serves one by a
+	// deterministic tie-break (see resolveDuplicates).
+	onDuplicate string
+
+	// blobExtensions lists extensions (e.g. ".pem") of companion files that
+	// are served as opaque base64 blobs. Blobs are keyed by their full
+	// relative path, extension included (e.g. "cert.pem").
+	blobExtensions []string
+
+	// keyStyle joins the directories of a nested file's key with "/"
+	// (keyStylePath, "env/dev") or "." (keyStyleDotted, "env.dev"). Lookups
+	// accept either form (see alternateKey).
+	keyStyle string
+
+	// jailToRoot skips symlinked files whose target, once resolved, lies
+	// outside the scanned directory (see withinRoot), and rejects file_list
+	// entries that resolve outside it. Turning it off is the only way to list
+	// files elsewhere.
+	jailToRoot bool
+
+	// overlayDir, when set, is the absolute overlay directory unioned over
+	// the scanned (base) directory: an overlay file shadows the base file of
+	// the same key, and unshadowed base files stay visible (see
+	// enumerateCSLFiles). It is resolved by Init rather than parsed.
+	overlayDir string
+}
+
+// isBlob reports whether fileName has one of the blob extensions.
+func (opts scanOptions) isBlob(fileName string) bool {
+	for _, ext := range opts.blobExtensions {
+		if strings.HasSuffix(fileName, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values of the key_style option.
+const (
+	keyStylePath   = "path"
+	keyStyleDotted = "dotted"
+)
+
+// styledKey returns a slash-separated key in the configured key_style.
+func (opts scanOptions) styledKey(key string) string {
+	if opts.keyStyle == keyStyleDotted {
+		return strings.ReplaceAll(key, "/", ".")
+	}
+	return key
+}
+
+// alternateKey returns key written in the other key_style, for lookups:
+// "env.dev" becomes "env/dev" under keyStylePath and "env/dev" becomes
+// "env.dev" under keyStyleDotted. ok is false when key has no separator to
+// convert.
+func (opts scanOptions) alternateKey(key string) (string, bool) {
+	from, to := ".", "/"
+	if opts.keyStyle == keyStyleDotted {
+		from, to = "/", "."
+	}
+	if !strings.Contains(key, from) {
+		return "", false
+	}
+	return strings.ReplaceAll(key, from, to), true
+}
+
+// cslExtension is the file extension served by the provider.
+const cslExtension = ".csl"
+
+// Values of the extension_trim option.
+const (
+	extensionTrimLast = "last"
+	extensionTrimAll  = "all"
+)
+
+// baseName derives the key a file is served under from its slash-separated
+// relative path. ok is false when nothing but the extension remains (e.g. a
+// file named ".csl"), in which case the file is not served.
+func (opts scanOptions) baseName(relPath string) (name string, ok bool) {
+	if opts.keepExtension {
+		return relPath, true
+	}
+
+	dir, file := path.Split(relPath)
+
+	file = strings.TrimSuffix(file, cslExtension)
+	if opts.extensionTrim == extensionTrimAll {
+		for strings.HasSuffix(file, cslExtension) {
+			file = strings.TrimSuffix(file, cslExtension)
+		}
+	}
+
+	if file == "" {
+		return "", false
+	}
+	return dir + file, true
+}
+
+// enumerationError maps an enumeration failure to a gRPC status, preserving
+// context cancellation, deadlines, and status codes set during enumeration so
+// callers can tell them apart.
+func enumerationError(msg string, err error) error {
+	if st, ok := status.FromError(err); ok {
+		return status.Errorf(st.Code(), "%s: %s", msg, st.Message())
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Errorf(codes.DeadlineExceeded, "%s: %v", msg, err)
+	case errors.Is(err, context.Canceled):
+		return status.Errorf(codes.Canceled, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+// enumerateCSLFiles scans the directory for .csl files (and blob files, when
+// configured). At least one .csl file is required unless opts.lazy is set,
+// in which case nothing is enumerated. With opts.overlayDir, the overlay is
+// scanned too and its files replace the directory's files of the same key;
+// duplicates are resolved within each directory, never across them.
+//
+// Directory reads run in a separate goroutine so that a hung filesystem
+// cannot block past ctx; the context is also checked between entries.
+func (s *FileProviderService) enumerateCSLFiles(ctx context.Context, dirPath string, opts scanOptions) (map[string]string, error) {
+	if opts.lazy {
+		return make(map[string]string), nil
+	}
+
+	if len(opts.fileList) > 0 {
+		candidates, err := listFiles(dirPath, opts)
+		if err != nil {
+			return nil, err
+		}
+		return opts.resolveDuplicates(candidates)
+	}
+
+	cslFiles, err := s.scanLayer(ctx, dirPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.overlayDir != "" {
+		overlayFiles, err := s.scanLayer(ctx, opts.overlayDir, opts)
+		if err != nil {
+			return nil, err
+		}
+		for key, filePath := range overlayFiles {
+			cslFiles[key] = filePath
+		}
+	}
+
+	hasCSL := false
+	for _, filePath := range cslFiles {
+		if strings.HasSuffix(filePath, cslExtension) {
+			hasCSL = true
+			break
+		}
+	}
+	if !hasCSL {
+		return nil, fmt.Errorf("no .csl files found in directory")
+	}
+
+	return cslFiles, nil
+}
+
+// scanLayer scans one directory and resolves duplicate base names within it.
+func (s *FileProviderService) scanLayer(ctx context.Context, dirPath string, opts scanOptions) (map[string]string, error) {
+	candidates := make(map[string][]fileCandidate)
+	if err := s.scanDir(ctx, dirPath, dirPath, "", opts, candidates); err != nil {
+		return nil, err
+	}
+	return opts.resolveDuplicates(candidates)
+}
+
+// fileCandidate is a file that may be served under a base name. path is the
+// slash-separated path used to break ties between duplicates: relative to
+// the scanned directory, or the absolute path of a file_list entry.
+type fileCandidate struct {
+	path     string
+	filePath string
+}
+
+// Values of the on_duplicate option.
+const (
+	onDuplicateError     = "error"
+	onDuplicateFirstWins = "first_wins"
+)
+
+// resolveDuplicates picks the file served under each base name. When several
+// files share a base name, on_duplicate "error" fails naming all of them,
+// while "first_wins" serves the first by a deterministic rule independent of
+// walk order: the shallowest path (fewest directory levels), then the
+// lexicographically smallest path.
+func (opts scanOptions) resolveDuplicates(candidates map[string][]fileCandidate) (map[string]string, error) {
+	baseNames := make([]string, 0, len(candidates))
+	for baseName := range candidates {
+		baseNames = append(baseNames, baseName)
+	}
+	sort.Strings(baseNames)
+
+	cslFiles := make(map[string]string, len(candidates))
+	for _, baseName := range baseNames {
+		files := candidates[baseName]
+		if len(files) > 1 {
+			sort.Slice(files, func(i, j int) bool {
+				di, dj := strings.Count(files[i].path, "/"), strings.Count(files[j].path, "/")
+				if di != dj {
+					return di < dj
+				}
+				return files[i].path < files[j].path
+			})
+
+			if opts.onDuplicate != onDuplicateFirstWins {
+				paths := make([]string, len(files))
+				for i, f := range files {
+					paths[i] = f.path
+				}
+				sort.Strings(paths)
+				return nil, fmt.Errorf("duplicate file base name %q: %q", baseName, paths)
+			}
+		}
+		cslFiles[baseName] = files[0].filePath
+	}
+	return cslFiles, nil
+}
+
+// listFiles collects the files of opts.fileList. A relative entry is keyed
+// like a scanned file at that relative path (e.g. "env/dev.csl" -> "env/dev");
+// an absolute entry by its file name alone. Missing entries, directories,
+// files that are neither .csl nor blobs, and (under opts.jailToRoot) entries
+// resolving outside dirPath are errors.
+func listFiles(dirPath string, opts scanOptions) (map[string][]fileCandidate, error) {
+	candidates := make(map[string][]fileCandidate, len(opts.fileList))
+	for _, entry := range opts.fileList {
+		filePath, relPath := entry, filepath.ToSlash(filepath.Clean(entry))
+		tiePath := relPath
+		if filepath.IsAbs(entry) {
+			relPath = filepath.Base(entry)
+		} else {
+			if relPath == ".." || strings.HasPrefix(relPath, "../") {
+				return nil, status.Errorf(codes.InvalidArgument,
+					"file_list entry %q climbs out of %s; list files elsewhere by absolute path", entry, dirPath)
+			}
+			filePath = filepath.Join(dirPath, entry)
+		}
+
+		info, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "file_list entry %q does not exist: %s", entry, filePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("file_list entry %q: %w", entry, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, status.Errorf(codes.InvalidArgument, "file_list entry %q is not a regular file", entry)
+		}
+		if opts.jailToRoot && !withinRoot(dirPath, filePath) {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"file_list entry %q resolves outside %s; set jail_to_root to false to list files elsewhere", entry, dirPath)
+		}
+
+		baseName, ok := relPath, true
+		switch {
+		case strings.HasSuffix(relPath, cslExtension):
+			baseName, ok = opts.baseName(relPath)
+		case !opts.isBlob(relPath):
+			ok = false
+		}
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "file_list entry %q is not a %s file", entry, cslExtension)
+		}
+		baseName = opts.styledKey(baseName)
+		candidates[baseName] = append(candidates[baseName], fileCandidate{path: tiePath, filePath: filePath})
+	}
+
+	return candidates, nil
+}
+
+// scanDir adds the .csl files in dirPath to candidates, keyed by base name,
+// recursing into subdirectories when opts.recursive is set. relDir is the
+// slash-separated path of dirPath relative to the scan root ("" for the root
+// itself).
+func (s *FileProviderService) scanDir(ctx context.Context, root, dirPath, relDir string, opts scanOptions, candidates map[string][]fileCandidate) error {
+	entries, err := s.readDirContext(ctx, dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fileName := entry.Name()
+		relPath := path.Join(relDir, fileName)
+
+		if entry.IsDir() {
+			if opts.recursive {
+				if err := s.scanDir(ctx, root, filepath.Join(dirPath, fileName), relPath, opts, candidates); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		isCSL := strings.HasSuffix(fileName, cslExtension)
+		if !isCSL && !opts.isBlob(fileName) {
+			continue
+		}
+
+		if !opts.matches(relPath) {
+			continue
+		}
+
+		baseName, ok := relPath, true
+		if isCSL {
+			baseName, ok = opts.baseName(relPath)
+		}
+		if !ok {
+			continue
+		}
+		baseName = opts.styledKey(baseName)
+
+		filePath := filepath.Join(dirPath, fileName)
+		if opts.jailToRoot && entry.Type()&os.ModeSymlink != 0 && !withinRoot(root, filePath) {
+			log.Printf("warning: skipping %s: symlink resolves outside %s", filePath, root)
+			continue
+		}
+		candidates[baseName] = append(candidates[baseName], fileCandidate{
+			path:     relPath,
+			filePath: filePath,
+		})
+	}
+
+	return nil
+}
+
+// withinRoot reports whether filePath, with symlinks resolved, lies inside
+// root (also resolved). Paths that cannot be resolved are not within root.
+func withinRoot(root, filePath string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// matches reports whether relPath passes the include and exclude patterns.
+func (opts scanOptions) matches(relPath string) bool {
+	if len(opts.include) > 0 {
+		included := false
+		for _, pattern := range opts.include {
+			if matchGlob(pattern, relPath) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, pattern := range opts.exclude {
+		if matchGlob(pattern, relPath) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readDirContext reads a directory, giving up when ctx is done.
+func (s *FileProviderService) readDirContext(ctx context.Context, dirPath string) ([]os.DirEntry, error) {
+	type readResult struct {
+		entries []os.DirEntry
+		err     error
+	}
+
+	done := make(chan readResult, 1)
+	go func() {
+		entries, err := s.readDir(dirPath)
+		done <- readResult{entries: entries, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-done:
+		if result.err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", result.err)
+		}
+		return result.entries, nil
+	}
+}
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// jsonSchemaDialect is the JSON Schema draft inferred schemas declare.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// fetchSchemaJSON infers a JSON Schema describing a file's structure.
+//
+// Path: ["__schema_json__", <fetch path>...], e.g. ["__schema_json__", "app"]
+// or ["__schema_json__", "app", "database"]. The schema is inferred from the
+// converted data, not authored: every key observed in a map is a required
+// property, scalars are typed "boolean", "integer", "number" or "string" by
+// what they hold, and a list's "items" is the schema its elements share, or
+// an "anyOf" of their distinct schemas.
+func (s *FileProviderService) fetchSchemaJSON(ctx context.Context, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a file path", controlSchemaJSON)
+	}
+
+	target, err := s.resolveTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	if target.all {
+		return nil, status.Errorf(codes.InvalidArgument, `%s does not support path ["*"]`, controlSchemaJSON)
+	}
+
+	data, err := s.loadFile(target.filePath)
+	if err != nil {
+		return nil, parseStatus("failed to parse file", err)
+	}
+	data, err = s.navigate(data, s.scopedKeys(target.filePath, target.keys), args)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := inferSchema(data)
+	schema["$schema"] = jsonSchemaDialect
+	return schema, nil
+}
+
+// inferSchema returns the JSON Schema of a converted value.
+func inferSchema(v any) map[string]any {
+	switch val := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		properties := make(map[string]any, len(val))
+		for k, child := range val {
+			keys = append(keys, k)
+			properties[k] = inferSchema(child)
+		}
+		sort.Strings(keys)
+		return map[string]any{
+			"type":       "object",
+			"properties": properties,
+			"required":   stringsToAny(keys),
+		}
+
+	case []any:
+		schema := map[string]any{"type": "array"}
+		if items := itemsSchema(val); items != nil {
+			schema["items"] = items
+		}
+		return schema
+
+	case string:
+		switch scalarType(val) {
+		case scalarBool:
+			return map[string]any{"type": "boolean"}
+		case scalarNumber:
+			if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+				return map[string]any{"type": "integer"}
+			}
+			return map[string]any{"type": "number"}
+		default:
+			return map[string]any{"type": "string"}
+		}
+
+	case bool:
+		return map[string]any{"type": "boolean"}
+
+	case float64, int, int64:
+		return map[string]any{"type": "number"}
+
+	default:
+		return map[string]any{"type": "null"}
+	}
+}
+
+// itemsSchema returns the schema shared by the elements of a list, an
+// "anyOf" of their distinct schemas in first-seen order, or nil for an empty
+// list.
+func itemsSchema(list []any) map[string]any {
+	var distinct []any
+	seen := make(map[string]bool)
+	for _, elem := range list {
+		schema := inferSchema(elem)
+		// encoding/json sorts map keys, so equal schemas encode equally
+		encoded, _ := json.Marshal(schema)
+		if seen[string(encoded)] {
+			continue
+		}
+		seen[string(encoded)] = true
+		distinct = append(distinct, schema)
+	}
+
+	switch len(distinct) {
+	case 0:
+		return nil
+	case 1:
+		return distinct[0].(map[string]any)
+	default:
+		return map[string]any{"anyOf": distinct}
+	}
+}
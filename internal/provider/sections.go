@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchSections counts the top-level sections of files, for an inventory
+// view that does not transfer their content.
+//
+// Path: ["__sections__"] for every file, or ["__sections__", "file"] for one.
+// The result is {"files": {"name": N, ...}}. Counts come from the cached
+// parse of each file; top-level scalar entries, imports and other reserved
+// keys (e.g. "__root__") are not sections. Blob files are skipped.
+func (s *FileProviderService) fetchSections(ctx context.Context, args []string) (any, error) {
+	if len(args) > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects at most one file name", controlSections)
+	}
+
+	names := make([]string, 0, len(s.config.cslFiles))
+	if len(args) == 1 {
+		if _, exists := s.config.lookupFile(args[0]); !exists {
+			return nil, status.Errorf(codes.NotFound, "file %q not found", args[0])
+		}
+		names = append(names, args[0])
+	} else {
+		if s.config.scan.lazy {
+			return nil, errLazyScan(controlSections)
+		}
+		for name := range s.config.cslFiles {
+			names = append(names, name)
+		}
+	}
+
+	counts := make(map[string]any, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		filePath, _ := s.config.lookupFile(name)
+		if !isCSLFile(filePath) {
+			continue
+		}
+		data, err := s.parseFile(filePath)
+		if err != nil {
+			return nil, parseStatus(fmt.Sprintf("failed to parse file %q", name), err)
+		}
+		counts[name] = countSections(data)
+	}
+
+	return map[string]any{"files": counts}, nil
+}
+
+// countSections returns the number of top-level sections in converted file
+// data: map values under keys that are not reserved.
+func countSections(data any) int {
+	m, _ := data.(map[string]any)
+	n := 0
+	for key, value := range m {
+		if strings.HasPrefix(key, "__") && strings.HasSuffix(key, "__") {
+			continue
+		}
+		if _, ok := value.(map[string]any); ok {
+			n++
+		}
+	}
+	return n
+}
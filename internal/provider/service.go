@@ -32,26 +32,197 @@ package provider
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
 	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // providerConfig represents the provider's single configuration.
 type providerConfig struct {
-	alias       string
-	directory   string
-	cslFiles    map[string]string // base name -> absolute file path
-	initialized bool
+	alias               string
+	directory           string
+	roots               map[string]string // root name -> absolute directory; nil unless "roots" is configured
+	cslFiles            map[string]string // base name (or "root/base name") -> absolute file path
+	initTimeout         time.Duration
+	compatVersion       string        // output shape to reproduce; compatLatest by default
+	reloadInterval      time.Duration // re-enumeration period; 0 disables polling
+	scan                scanOptions
+	allowWrite          bool
+	maxBlobBytes        int      // size limit for blob_extensions files
+	maxBundleBytes      int      // size limit for __bundle__; 0 means no limit
+	fetchRoot           []string // keys prepended to every file navigation
+	activeVariant       string   // top-level section every file is read as; "" disables
+	strictVariant       bool     // a file lacking activeVariant fails instead of being read whole
+	defaultFile         string   // file used when path[0] names no file; "" disables
+	sourceInfo          bool     // add "__source__" provenance to file fetches
+	coercionReport      bool     // add "__coercion_candidates__" to file fetches
+	etag                bool     // add an HTTP-style "__etag__" to file fetches
+	caseInsensitiveKeys bool     // navigation matches map keys ignoring case
+	inheritParentKeys   bool     // navigated sections inherit enclosing sections' scalars
+	descendValueWrapper bool     // a "value" key at a non-map node is the result wrapper
+	followReferences    bool     // navigation descends through references to this provider's files
+	checkSourceAlias    bool     // warn at Init about source declarations with another alias
+	warnings            []any    // structured warnings found at Init (see __warnings__)
+	nonFiniteNumbers    string   // NaN/Inf handling: nonFiniteError or nonFiniteString
+	converter           converter
+	cache               *parseCache    // nil when cache_max_entries is 0
+	snapshots           *snapshotStore // nil unless snapshot_depth is set
+	initialized         bool
+}
+
+// referenceTarget resolves a reference to the absolute path of the file that
+// serves it, if the reference targets this provider's alias and a known file.
+func (c *providerConfig) referenceTarget(ref *ast.ReferenceExpr) (string, bool) {
+	filePath, _, ok := c.referenceFile(ref.Alias, ref.Path)
+	return filePath, ok
+}
+
+// referenceFile resolves a reference's alias and path to the file that
+// serves it and the keys to navigate within that file, as a Fetch of the
+// same path would.
+func (c *providerConfig) referenceFile(alias string, path []string) (filePath string, keys []string, ok bool) {
+	if alias != c.alias || len(path) == 0 {
+		return "", nil, false
+	}
+
+	key, keys := path[0], path[1:]
+	if c.roots != nil {
+		if len(path) < 2 {
+			return "", nil, false
+		}
+		key, keys = rootKey(path[0], path[1]), path[2:]
+	}
+
+	filePath, ok = c.lookupFile(key)
+	return filePath, keys, ok
+}
+
+// effective returns the resolved configuration as reported to operators.
+//
+// Values are normalized (e.g. directory is absolute) so the output reflects
+// what the provider is actually using rather than what was requested.
+func (c *providerConfig) effective() map[string]any {
+	effective := map[string]any{
+		"alias": c.alias,
+	}
+
+	if c.roots != nil {
+		roots := make(map[string]any, len(c.roots))
+		for name, dir := range c.roots {
+			roots[name] = dir
+		}
+		effective["roots"] = roots
+	} else if c.scan.overlayDir != "" {
+		effective["base_dir"] = c.directory
+		effective["overlay_dir"] = c.scan.overlayDir
+	} else {
+		effective["directory"] = c.directory
+	}
+
+	if c.initTimeout > 0 {
+		effective["init_timeout"] = c.initTimeout.String()
+	}
+	if c.reloadInterval > 0 {
+		effective["reload_interval"] = c.reloadInterval.String()
+	}
+
+	effective["recursive"] = c.scan.recursive
+	effective["lazy_scan"] = c.scan.lazy
+	effective["extension_trim"] = c.scan.extensionTrim
+	effective["keep_extension"] = c.scan.keepExtension
+	effective["on_duplicate"] = c.scan.onDuplicate
+	effective["jail_to_root"] = c.scan.jailToRoot
+	effective["key_style"] = c.scan.keyStyle
+	if len(c.scan.include) > 0 {
+		effective["include"] = stringsToAny(c.scan.include)
+	}
+	if len(c.scan.exclude) > 0 {
+		effective["exclude"] = stringsToAny(c.scan.exclude)
+	}
+	if len(c.scan.fileList) > 0 {
+		effective["file_list"] = stringsToAny(c.scan.fileList)
+	}
+	if len(c.scan.blobExtensions) > 0 {
+		effective["blob_extensions"] = stringsToAny(c.scan.blobExtensions)
+		effective["max_blob_bytes"] = c.maxBlobBytes
+	}
+	if c.maxBundleBytes > 0 {
+		effective["max_bundle_bytes"] = c.maxBundleBytes
+	}
+
+	effective["allow_write"] = c.allowWrite
+	effective["etag"] = c.etag
+	effective["source_info"] = c.sourceInfo
+	effective["report_coercion_candidates"] = c.coercionReport
+	if len(c.fetchRoot) > 0 {
+		effective["fetch_root"] = stringsToAny(c.fetchRoot)
+	}
+	if c.activeVariant != "" {
+		effective["active_variant"] = c.activeVariant
+		effective["strict_variant"] = c.strictVariant
+	}
+	if c.defaultFile != "" {
+		effective["default_file"] = c.defaultFile
+	}
+	effective["case_insensitive_keys"] = c.caseInsensitiveKeys
+	effective["inherit_parent_keys"] = c.inheritParentKeys
+	effective["descend_value_wrapper"] = c.descendValueWrapper
+	effective["follow_references"] = c.followReferences
+	effective["check_source_alias"] = c.checkSourceAlias
+	effective["non_finite_numbers"] = c.nonFiniteNumbers
+	cacheMaxEntries := 0
+	if c.cache != nil {
+		cacheMaxEntries = c.cache.maxEntries
+	}
+	effective["cache_max_entries"] = cacheMaxEntries
+	if c.cache != nil && c.cache.ttl > 0 {
+		effective["cache_ttl"] = c.cache.ttl.String()
+	}
+	if c.snapshots != nil {
+		effective["snapshot_depth"] = c.snapshots.depth
+	}
+	effective["compat_version"] = c.compatVersion
+	effective["ref_format"] = c.converter.refFormat
+	if c.converter.refAliasPrefix != "" {
+		effective["ref_alias_prefix"] = c.converter.refAliasPrefix
+	}
+	effective["root_entries"] = c.converter.rootEntries
+	effective["root_collision"] = c.converter.rootCollision
+	effective["normalize_units"] = c.converter.normalizeUnits
+	effective["typed_values"] = c.converter.typedValues
+	if len(c.converter.transforms) > 0 {
+		transforms := make(map[string]any, len(c.converter.transforms))
+		for _, t := range c.converter.transforms {
+			transforms[strings.Join(t.path, ".")] = t.name
+		}
+		effective["transforms"] = transforms
+	}
+	effective["inline_imports"] = c.converter.inlineImports
+	effective["strip_underscore_keys"] = c.converter.privateKeyPrefix != ""
+	if c.converter.privateKeyPrefix != "" {
+		effective["private_key_prefix"] = c.converter.privateKeyPrefix
+	}
+	maxDepth, maxNodes := c.converter.limits()
+	effective["max_depth"] = maxDepth
+	effective["max_nodes"] = maxNodes
+
+	return effective
 }
 
 // FileProviderService implements the nomos.provider.v1.ProviderService gRPC interface
@@ -76,19 +247,134 @@ type FileProviderService struct {
 	version      string
 	providerType string
 	config       *providerConfig
+
+	// readDir lists directory entries during enumeration. It defaults to
+	// os.ReadDir and is replaced in tests to simulate slow filesystems.
+	readDir func(name string) ([]os.DirEntry, error)
+
+	// readFile reads a .csl file for parsing. It defaults to os.ReadFile and
+	// is replaced in tests to count reads.
+	readFile func(name string) ([]byte, error)
+
+	// parser parses file contents. It defaults to libsParser and is replaced
+	// in tests to return crafted ASTs or errors.
+	parser Parser
+
+	// writeMu serializes guarded write-backs (see fetchSet), which run under
+	// the read lock alongside regular fetches.
+	writeMu sync.Mutex
+
+	// trace enables verbose logging of Fetch resolution and navigation.
+	// It is set from NOMOS_PROVIDER_TRACE=1 at construction.
+	trace bool
+
+	// debug enables the __debug__ control path. It is set from
+	// NOMOS_PROVIDER_DEBUG=1 at construction.
+	debug bool
+
+	// initWait bounds how long a Fetch that arrives before Init waits for
+	// it to complete. Zero (the default) fails fast. It is set from
+	// NOMOS_PROVIDER_FETCH_WAIT_FOR_INIT at construction.
+	initWait time.Duration
+
+	// workDir, when set, replaces the process working directory as the base
+	// of relative directories in an Init without a source file path. It is
+	// set from NOMOS_PROVIDER_WORKDIR at construction.
+	workDir string
+
+	// pollStop stops the reload_interval poller; nil when not polling.
+	pollStop chan struct{}
+
+	// ready is closed when Init succeeds and replaced on Shutdown.
+	ready chan struct{}
+
+	// metrics holds the counters that persist across Init calls.
+	metrics serviceMetrics
 }
 
+// traceEnvVar enables trace logging when set to "1".
+const traceEnvVar = "NOMOS_PROVIDER_TRACE"
+
+// fetchWaitEnvVar sets, as a duration string, how long an early Fetch waits
+// for Init. It must be a service-level setting because such a Fetch arrives
+// before any Init config is available.
+const fetchWaitEnvVar = "NOMOS_PROVIDER_FETCH_WAIT_FOR_INIT"
+
+// WorkDirEnvVar names the directory that relative directory and roots
+// entries resolve against when Init carries no source file path, in place of
+// the process working directory.
+const WorkDirEnvVar = "NOMOS_PROVIDER_WORKDIR"
+
 // NewFileProviderService creates a new file provider service.
 //
 // The service starts uninitialized. Call Init() to configure it.
+// Setting NOMOS_PROVIDER_TRACE=1 enables trace logging of every Fetch, and
+// NOMOS_PROVIDER_FETCH_WAIT_FOR_INIT (e.g. "2s") lets a Fetch that races ahead
+// of Init wait for it instead of failing immediately. NOMOS_PROVIDER_DEBUG=1
+// enables the __debug__ control path, and NOMOS_PROVIDER_WORKDIR overrides the
+// base of relative directories in standalone runs.
 func NewFileProviderService(version, providerType string) *FileProviderService {
+	initWait, err := time.ParseDuration(os.Getenv(fetchWaitEnvVar))
+	if err != nil || initWait < 0 {
+		initWait = 0
+	}
+
 	return &FileProviderService{
 		version:      version,
 		providerType: providerType,
 		config:       nil,
+		readDir:      os.ReadDir,
+		readFile:     os.ReadFile,
+		parser:       libsParser{},
+		trace:        os.Getenv(traceEnvVar) == "1",
+		debug:        os.Getenv(debugEnvVar) == "1",
+		initWait:     initWait,
+		workDir:      os.Getenv(WorkDirEnvVar),
+		ready:        make(chan struct{}),
 	}
 }
 
+// waitForInit blocks until Init has succeeded, the initWait bound elapses or
+// ctx ends, whichever comes first. It returns immediately if already
+// initialized.
+func (s *FileProviderService) waitForInit(ctx context.Context) {
+	s.mu.RLock()
+	initialized := s.config != nil && s.config.initialized
+	ready := s.ready
+	s.mu.RUnlock()
+
+	if initialized {
+		return
+	}
+
+	timer := time.NewTimer(s.initWait)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// peerAddr returns the address of the gRPC client that sent the request, or
+// "unknown" when there is none (e.g. an in-process call).
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	return p.Addr.String()
+}
+
+// tracef logs a trace message when trace mode is enabled.
+func (s *FileProviderService) tracef(format string, args ...any) {
+	if !s.trace {
+		return
+	}
+	log.Printf("trace: "+format, args...)
+}
+
 // Init initializes the provider with the given configuration.
 //
 // Since each provider process serves one configuration, Init should only be
@@ -96,7 +382,113 @@ func NewFileProviderService(version, providerType string) *FileProviderService {
 //
 // Required configuration:
 //   - req.Alias: identifier for this provider instance (for logging)
-//   - req.Config["directory"]: path to directory containing .csl files
+//   - req.Config["directory"]: path to directory containing .csl files, or
+//   - req.Config["roots"]: map of root name to directory, for serving several
+//     independently enumerated directories addressed by root name, or
+//   - req.Config["base_dir"] and req.Config["overlay_dir"]: two directories
+//     served as one read-only union, overlay files shadowing base files of
+//     the same base name; neither may be nested within the other
+//
+// Optional configuration:
+//   - req.Config["init_timeout"]: duration string (e.g. "10s") bounding
+//     directory enumeration; exceeding it fails Init with DeadlineExceeded
+//   - req.Config["reload_interval"]: duration string (e.g. "30s") at which
+//     the directory is re-enumerated, for filesystems where change
+//     notifications are unreliable; exclusive with lazy_scan
+//   - req.Config["recursive"]: scan subdirectories; nested files are keyed
+//     by relative path without extension (e.g. "env/dev")
+//   - req.Config["on_duplicate"]: "error" (default) fails when several
+//     files map to one base name; "first_wins" serves the shallowest, then
+//     lexicographically first, path
+//   - req.Config["file_list"]: list of files (absolute or relative to the
+//     directory) registered instead of scanning; a missing file fails Init,
+//     as does a relative entry starting with "..", or any other one outside
+//     the directory unless jail_to_root is false
+//   - req.Config["lazy_scan"]: skip enumeration at Init and resolve files on
+//     demand at Fetch; whole-directory features are unavailable
+//   - req.Config["include"], req.Config["exclude"]: glob patterns (with "**"
+//     support) selecting which files are enumerated
+//   - req.Config["blob_extensions"]: extensions (e.g. ".pem") of companion
+//     files served by full name as {"__blob__": true, "base64": ...} without
+//     parsing; req.Config["max_blob_bytes"] limits their size (default 1 MiB)
+//   - req.Config["compat_version"]: "latest" (default) or "0.2" to keep
+//     the 0.2 output shape (string scalars and references); options that
+//     change the shape are rejected alongside it
+//   - req.Config["ref_alias_prefix"]: prefix added to the alias of every
+//     reference in fetched data (e.g. "files." renders @network:vpc as
+//     alias "files.network")
+//   - req.Config["descend_value_wrapper"]: let a path continue through the
+//     synthetic "value" wrapper of a scalar or list result
+//   - req.Config["max_bundle_bytes"]: size limit of the "__bundle__"
+//     control path's JSON document (default no limit)
+//   - req.Config["extension_trim"]: "last" (default) strips only the final
+//     ".csl" from file names; "all" strips every trailing ".csl"
+//   - req.Config["keep_extension"]: key files by their full name, extension
+//     included (e.g. "config.csl")
+//   - req.Config["allow_write"]: enable the guarded "__set__" write-back
+//     control path (off by default)
+//   - req.Config["root_entries"]: "inline" (default) or "nested" placement
+//     of top-level scalar entries
+//   - req.Config["root_collision"]: "error" (default), "section_wins" or
+//     "entry_wins" when an inline top-level entry and a section share a name
+//   - req.Config["normalize_units"]: convert size/time suffixed scalars
+//     such as "512mb" or "30s" into {"value", "unit"} objects
+//   - req.Config["fetch_root"]: list of keys prepended to every file
+//     navigation, so only the subtree beneath it is reachable
+//   - req.Config["active_variant"]: top-level section every file is read
+//     as, so paths resolve within it; a file without it is read whole, or
+//     fails with NotFound when req.Config["strict_variant"] is true
+//   - req.Config["default_file"]: base name of the file to fetch from when
+//     path[0] is not a known file, so ["database", "host"] resolves against
+//     it; must name an enumerated file
+//   - req.Config["source_info"]: add a "__source__" entry naming the root,
+//     directory and file that served each file fetch
+//   - req.Config["report_coercion_candidates"]: add a
+//     "__coercion_candidates__" list of the keys whose string values read as
+//     numbers or booleans
+//   - req.Config["etag"]: add a quoted, content-addressed "__etag__" to
+//     file fetches (and an "etag" response header)
+//   - req.Config["inline_imports"]: inline top-level imports ("@alias:file")
+//     of this provider's files under the alias key; others are listed under
+//     "__imports__"
+//   - req.Config["typed_values"]: render durations and RFC 3339 timestamps
+//     as google.protobuf.Any JSON objects; exclusive with normalize_units
+//   - req.Config["transforms"]: map of dotted value path (relative to each
+//     file's root) to a transform ("base64decode", "trim", "lower") applied
+//     to the string value there during conversion
+//   - req.Config["case_insensitive_keys"]: match map keys ignoring case
+//     during navigation; keys differing only by case are ambiguous
+//   - req.Config["inherit_parent_keys"]: a fetched section inherits the
+//     scalar keys of its enclosing sections (child wins; lists and maps are
+//     never merged)
+//   - req.Config["follow_references"]: when a Fetch path continues beneath
+//     a reference to this provider's files, descend into its target instead
+//     of failing
+//   - req.Config["key_style"]: "path" (default, "env/dev") or "dotted"
+//     ("env.dev") keys for nested files; Fetch accepts both forms
+//   - req.Config["jail_to_root"]: skip symlinked files whose target lies
+//     outside the configured directory, and reject file_list entries that
+//     resolve outside it (default true); set false to list files elsewhere
+//   - req.Config["strip_underscore_keys"]: omit keys starting with
+//     req.Config["private_key_prefix"] (default "_") at any depth
+//   - req.Config["check_source_alias"]: warn when a file declares a source
+//     of this provider's type under a different alias (see __warnings__)
+//   - req.Config["non_finite_numbers"]: "error" (default) fails a fetch
+//     whose value holds NaN or ±Inf; "string" returns "NaN", "+Inf", "-Inf"
+//   - req.Config["cache_max_entries"]: number of parsed files kept in the
+//     LRU parse cache (default 128); 0 disables caching
+//   - req.Config["cache_ttl"]: duration (e.g. "30s") after which a cached
+//     parse expires even if the file's modtime and size are unchanged
+//   - req.Config["snapshot_depth"]: number of parsed versions retained per
+//     file, selectable with the "version" request header (e.g. "-1")
+//   - req.Config["max_depth"], req.Config["max_nodes"]: limits on nesting
+//     depth and values converted per file; exceeding them fails Fetch with
+//     ResourceExhausted
+//
+// Unknown config keys are rejected with InvalidArgument, suggesting close
+// matches, unless req.Config["ignore_unknown_config"] is true. Any key can be
+// overridden by a NOMOS_PROVIDER_CONFIG_<KEY> environment variable (see
+// applyEnvConfig).
 //
 // Validation:
 //   - Directory must exist and be readable
@@ -113,95 +505,244 @@ func (s *FileProviderService) Init(ctx context.Context, req *providerv1.InitRequ
 	if req.Alias == "" {
 		return nil, status.Error(codes.InvalidArgument, "alias cannot be empty")
 	}
+	if req.Config == nil {
+		return nil, status.Error(codes.InvalidArgument, "config is required")
+	}
 
-	// Extract directory from config
 	configMap := req.Config.AsMap()
-	dirValue, ok := configMap["directory"]
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "missing required config key 'directory'")
+	if err := applyEnvConfig(configMap); err != nil {
+		return nil, err
 	}
 
-	dirStr, ok := dirValue.(string)
-	if !ok {
-		return nil, status.Errorf(codes.InvalidArgument, "directory must be a string, got %T", dirValue)
+	if err := checkUnknownKeys(configMap); err != nil {
+		return nil, err
+	}
+
+	config, err := parseConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+	config.alias = req.Alias
+	config.converter.parser = s.parser
+	config.initialized = true
+
+	if config.initTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.initTimeout)
+		defer cancel()
+	}
+
+	directory, overlay, roots, err := parseLocation(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	if roots != nil {
+		config.roots = make(map[string]string, len(roots))
+		config.cslFiles = make(map[string]string)
+		for name, dirStr := range roots {
+			absPath, err := resolveDirectory(dirStr, req.SourceFilePath, s.workDir, config.scan)
+			if err != nil {
+				return nil, err
+			}
+
+			// Each root is enumerated independently, so base names only
+			// collide within a root.
+			rootFiles, err := s.enumerateCSLFiles(ctx, absPath, config.scan)
+			if err != nil {
+				return nil, enumerationError(fmt.Sprintf("failed to enumerate .csl files for root %q", name), err)
+			}
+
+			config.roots[name] = absPath
+			for baseName, filePath := range rootFiles {
+				config.cslFiles[rootKey(name, baseName)] = filePath
+			}
+		}
+	} else {
+		absPath, err := resolveDirectory(directory, req.SourceFilePath, s.workDir, config.scan)
+		if err != nil {
+			return nil, err
+		}
+		if overlay != "" {
+			if config.scan.overlayDir, err = resolveDirectory(overlay, req.SourceFilePath, s.workDir, config.scan); err != nil {
+				return nil, err
+			}
+			if err := checkLayers(absPath, config.scan.overlayDir); err != nil {
+				return nil, err
+			}
+		}
+
+		// Enumerate CSL files
+		cslFiles, err := s.enumerateCSLFiles(ctx, absPath, config.scan)
+		if err != nil {
+			return nil, enumerationError("failed to enumerate .csl files", err)
+		}
+
+		config.directory = absPath
+		config.cslFiles = cslFiles
+	}
+
+	if config.defaultFile != "" && config.roots == nil {
+		if _, exists := config.lookupFile(config.defaultFile); !exists {
+			return nil, status.Errorf(codes.InvalidArgument, "default_file %q not found", config.defaultFile)
+		}
+	}
+
+	if config.checkSourceAlias {
+		config.warnings = s.checkSourceAliases(config)
+	}
+
+	s.config = config
+	s.startPolling(config)
+
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
 	}
 
-	// Resolve to absolute path
+	if config.roots != nil {
+		log.Printf("Initialized provider: alias=%q roots=%d files=%d", req.Alias, len(config.roots), len(config.cslFiles))
+	} else {
+		log.Printf("Initialized provider: alias=%q directory=%q files=%d", req.Alias, config.directory, len(config.cslFiles))
+	}
+
+	return &providerv1.InitResponse{}, nil
+}
+
+// resolveDirectory resolves dir to an absolute path and verifies that it is an
+// existing directory. Relative paths are resolved against the directory of
+// sourceFilePath when one is given, otherwise against workDir or, when that
+// is empty, the working directory. A path naming a file fails with an
+// explanation suited to opts (see notDirectoryError).
+func resolveDirectory(dir, sourceFilePath, workDir string, opts scanOptions) (string, error) {
 	var absPath string
-	if !filepath.IsAbs(dirStr) && req.SourceFilePath != "" {
-		sourceDir := filepath.Dir(req.SourceFilePath)
-		absPath = filepath.Join(sourceDir, dirStr)
+	if !filepath.IsAbs(dir) && sourceFilePath != "" {
+		sourceDir := filepath.Dir(sourceFilePath)
+		absPath = filepath.Join(sourceDir, dir)
 	} else {
+		if !filepath.IsAbs(dir) && workDir != "" {
+			dir = filepath.Join(workDir, dir)
+		}
 		var err error
-		absPath, err = filepath.Abs(dirStr)
+		absPath, err = filepath.Abs(dir)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "failed to resolve path: %v", err)
+			return "", status.Errorf(codes.InvalidArgument, "failed to resolve path: %v", err)
 		}
 	}
+	// Join and Abs already clean; keep the invariant explicit, since file
+	// keys, metadata and jail_to_root checks are all derived from absPath
+	absPath = filepath.Clean(absPath)
 
 	// Verify directory exists
 	info, err := os.Stat(absPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, status.Errorf(codes.NotFound, "directory does not exist: %s", absPath)
+			return "", status.Errorf(codes.NotFound, "directory does not exist: %s", absPath)
 		}
-		return nil, status.Errorf(codes.Internal, "failed to stat directory: %v", err)
+		return "", status.Errorf(codes.Internal, "failed to stat directory: %v", err)
 	}
 
 	if !info.IsDir() {
-		return nil, status.Errorf(codes.InvalidArgument, "path is not a directory: %s", absPath)
+		return "", notDirectoryError(absPath, opts)
 	}
 
-	// Enumerate CSL files
-	cslFiles, err := s.enumerateCSLFiles(absPath)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to enumerate .csl files: %v", err)
-	}
+	return absPath, nil
+}
 
-	// Create configuration
-	s.config = &providerConfig{
-		alias:       req.Alias,
-		directory:   absPath,
-		cslFiles:    cslFiles,
-		initialized: true,
+// notDirectoryError explains a directory (or root) that names a file. Every
+// mode requires a directory; the hint follows the mode that would otherwise
+// apply, in order of precedence: file_list, lazy_scan, recursive, then plain
+// scanning.
+func notDirectoryError(absPath string, opts scanOptions) error {
+	var hint string
+	switch {
+	case len(opts.fileList) > 0:
+		hint = "file_list entries are resolved relative to a directory; set directory to the files' parent"
+	case opts.lazy:
+		hint = "lazy_scan resolves files within a directory; set directory to the file's parent"
+	case opts.recursive:
+		hint = "recursive scanning requires a directory to descend into; set directory to the file's parent"
+	default:
+		hint = "to serve a single file, set directory to its parent and list the file in file_list"
 	}
+	return status.Errorf(codes.InvalidArgument, "path is not a directory: %s (%s)", absPath, hint)
+}
 
-	log.Printf("Initialized provider: alias=%q directory=%q files=%d", req.Alias, absPath, len(cslFiles))
+// rootKey returns the cslFiles key for a file served from a named root.
+func rootKey(root, baseName string) string {
+	return root + "/" + baseName
+}
 
-	return &providerv1.InitResponse{}, nil
+// fetchTarget is a Fetch path resolved against the configured files.
+type fetchTarget struct {
+	prefix   string   // root prefix of the file key ("" without roots)
+	all      bool     // path was ["*"]: merge every file under prefix
+	key      string   // file key in cslFiles (prefix + base name)
+	filePath string   // absolute path of the file to read
+	keys     []string // keys to navigate within the file
+	expand   bool     // path ended in "*": return the target's children
 }
 
-// enumerateCSLFiles scans the directory for .csl files.
-func (s *FileProviderService) enumerateCSLFiles(dirPath string) (map[string]string, error) {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
-	}
+// resolveTarget resolves a (non-control) Fetch path to the file it reads,
+// applying roots routing and the default_file fallback.
+func (s *FileProviderService) resolveTarget(reqPath []string) (fetchTarget, error) {
+	var target fetchTarget
 
-	cslFiles := make(map[string]string)
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	path := reqPath
+	if s.config.roots != nil {
+		// With roots configured, path[0] names the root and path[1] the file.
+		if _, exists := s.config.roots[path[0]]; !exists {
+			return target, status.Errorf(codes.NotFound, "root %q not found", path[0])
 		}
-
-		fileName := entry.Name()
-		if !strings.HasSuffix(fileName, ".csl") {
-			continue
+		if len(path) < 2 {
+			return target, status.Errorf(codes.InvalidArgument, "path must include a file name after root %q", path[0])
 		}
+		target.prefix = rootKey(path[0], "")
+		path = path[1:]
+	}
+
+	if len(path) == 1 && path[0] == "*" {
+		target.all = true
+		return target, nil
+	}
+
+	if path[0] == "" {
+		return target, status.Errorf(codes.InvalidArgument, "path[%d] cannot be empty", len(reqPath)-len(path))
+	}
 
-		baseName := strings.TrimSuffix(fileName, ".csl")
-		if _, exists := cslFiles[baseName]; exists {
-			return nil, fmt.Errorf("duplicate file base name %q", baseName)
+	// Fall back to the default file when path[0] names no file
+	if s.config.defaultFile != "" {
+		if _, exists := s.config.lookupFile(target.prefix + path[0]); !exists {
+			s.tracef("fetch %q: no file %q, using default file %q", reqPath, target.prefix+path[0], s.config.defaultFile)
+			path = append([]string{s.config.defaultFile}, path...)
 		}
+	}
 
-		cslFiles[baseName] = filepath.Join(dirPath, fileName)
+	if len(path) > 1 && path[len(path)-1] == "*" {
+		target.expand = true
+		path = path[:len(path)-1]
 	}
 
-	if len(cslFiles) == 0 {
-		return nil, fmt.Errorf("no .csl files found in directory")
+	// path[0] is the filename
+	baseName := path[0]
+
+	// Look up file
+	if files, ambiguous := s.config.keyConflict(target.prefix + baseName); ambiguous {
+		s.tracef("fetch %q: file %q is ambiguous: %q", reqPath, target.prefix+baseName, files)
+		return target, errPathAmbiguous(baseName, files)
 	}
+	filePath, exists := s.config.lookupFile(target.prefix + baseName)
+	if !exists {
+		s.tracef("fetch %q: file %q not found", reqPath, target.prefix+baseName)
+		return target, status.Errorf(codes.NotFound, "file %q not found", baseName)
+	}
+	s.tracef("fetch %q: resolved file %q to %s", reqPath, target.prefix+baseName, filePath)
 
-	return cslFiles, nil
+	target.key = target.prefix + baseName
+	target.filePath = filePath
+	target.keys = path[1:]
+	return target, nil
 }
 
 // Fetch retrieves configuration data from a .csl file.
@@ -211,29 +752,62 @@ func (s *FileProviderService) enumerateCSLFiles(dirPath string) (map[string]stri
 //	path[0]: file base name (without .csl extension)
 //	path[1+]: optional nested keys within the file
 //
+// Each segment after the file name is matched literally against one map key;
+// segments are never split on "." so keys containing dots are addressable as
+// a single segment (e.g. ["app", "app", "some.dotted.key"]).
+//
 // Examples:
 //
 //	path=["database"]           → reads database.csl (entire file)
 //	path=["database", "host"]   → reads database.csl, extracts "host" key
 //	path=["prod", "database"]   → reads prod.csl, extracts "database" key
+//
+// When "roots" is configured, path[0] selects the root and the remaining
+// segments are interpreted as above within that root:
+//
+//	path=["tenantA", "database", "host"] → reads <tenantA root>/database.csl
+//
+// A request carrying the "if-none-match" metadata header is a conditional
+// fetch; see conditional.go.
+//
+// A fetch that fails because its context was cancelled or its deadline
+// passed is counted in the fetch_cancelled_total or
+// fetch_deadline_exceeded_total metric.
 func (s *FileProviderService) Fetch(ctx context.Context, req *providerv1.FetchRequest) (*providerv1.FetchResponse, error) {
+	resp, err := s.fetch(ctx, req)
+	if err != nil {
+		s.metrics.recordContextEnd(ctx, err)
+	}
+	return resp, err
+}
+
+// fetch serves Fetch.
+func (s *FileProviderService) fetch(ctx context.Context, req *providerv1.FetchRequest) (*providerv1.FetchResponse, error) {
+	if s.initWait > 0 {
+		s.waitForInit(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// Check if initialized
 	if s.config == nil || !s.config.initialized {
-		return nil, status.Error(codes.FailedPrecondition, "provider not initialized")
+		return nil, errNotInitialized()
 	}
 
 	// Validate path
 	if len(req.Path) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "path cannot be empty")
 	}
+	s.tracef("fetch %q: peer=%s", req.Path, peerAddr(ctx))
 
-	if len(req.Path) == 1 && req.Path[0] == "*" {
-		data, err := s.fetchAllFiles()
+	if handler, ok := controlHandlers[req.Path[0]]; ok {
+		data, err := handler(s, ctx, req.Path[1:])
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to fetch all files: %v", err)
+			return nil, err
 		}
 
 		value, err := toProtoStruct(data)
@@ -244,56 +818,183 @@ func (s *FileProviderService) Fetch(ctx context.Context, req *providerv1.FetchRe
 		return &providerv1.FetchResponse{Value: value}, nil
 	}
 
-	if req.Path[0] == "" {
-		return nil, status.Error(codes.InvalidArgument, "path[0] cannot be empty")
+	target, err := s.resolveTarget(req.Path)
+	if err != nil {
+		return nil, err
 	}
 
-	path := req.Path
-	expandWildcard := false
-	if len(path) > 1 && path[len(path)-1] == "*" {
-		expandWildcard = true
-		path = path[:len(path)-1]
+	limit, limited, err := listLimit(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// path[0] is the filename
-	baseName := path[0]
+	version, err := requestedVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	// Look up file
-	filePath, exists := s.config.cslFiles[baseName]
-	if !exists {
-		return nil, status.Errorf(codes.NotFound, "file %q not found", baseName)
+	aggregateName, aggregated, err := requestedAggregate(ctx)
+	if err != nil {
+		return nil, err
 	}
+	historical := version != 0
 
-	// Parse the file
-	data, err := parseCSLFile(filePath)
+	sampled, err := boolHeader(ctx, sampleHeader)
+	if err != nil {
+		return nil, err
+	}
+	skeleton, err := boolHeader(ctx, skeletonHeader)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to parse file: %v", err)
+		return nil, err
+	}
+	if sampled && skeleton {
+		return nil, status.Errorf(codes.InvalidArgument, "%s and %s cannot be combined", sampleHeader, skeletonHeader)
 	}
 
-	// Navigate to nested path if provided
-	if len(path) > 1 {
-		current := data
-		for i, key := range path[1:] {
-			m, ok := current.(map[string]any)
-			if !ok {
-				return nil, status.Errorf(codes.InvalidArgument,
-					"cannot navigate: element at index %d is not a map", i+1)
-			}
+	projection, projected, err := requestedProjection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if projected && aggregated {
+		return nil, status.Errorf(codes.InvalidArgument, "%s and %s cannot be combined", projectionHeader, aggregateHeader)
+	}
 
-			val, exists := m[key]
-			if !exists {
-				return nil, status.Errorf(codes.NotFound, "key %q not found", key)
-			}
+	if target.all {
+		if s.config.scan.lazy {
+			return nil, errLazyScan(`path ["*"]`)
+		}
+		if historical {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported for path [\"*\"]", versionHeader)
+		}
+		if aggregated {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported for path [\"*\"]", aggregateHeader)
+		}
+		if projected {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported for path [\"*\"]", projectionHeader)
+		}
+
+		data, err := s.fetchAllFiles(target.prefix)
+		if err != nil {
+			return nil, parseStatus("failed to fetch all files", err)
+		}
+
+		all, err := s.config.handleNonFinite(data)
+		if err != nil {
+			return nil, err
+		}
+		if sampled {
+			all = sampleValue(all)
+		}
+		if skeleton {
+			all = skeletonValue(all)
+		}
+		truncated := false
+		if limited {
+			all, truncated = truncateLists(all, limit)
+		}
 
-			current = val
+		value, err := toProtoStruct(all)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to convert data: %v", err)
+		}
+		if truncated {
+			value.Fields[truncatedKey] = structpb.NewBoolValue(true)
 		}
-		data = current
+		value, err = setCanonicalJSON(ctx, value, all)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+
+		return &providerv1.FetchResponse{Value: value}, nil
 	}
+	filePath := target.filePath
 
-	if expandWildcard {
-		if _, ok := data.(map[string]any); !ok {
-			return nil, status.Error(codes.InvalidArgument, "cannot expand: target is not a map")
+	// Parse the file, or take a retained version of it
+	var data any
+	var timing *parseTiming
+	if historical {
+		if data, err = s.snapshotData(filePath, version); err != nil {
+			return nil, err
+		}
+	} else {
+		var parsed parseTiming
+		if data, parsed, err = s.loadFileTimed(filePath); err != nil {
+			return nil, parseStatus("failed to parse file", err)
 		}
+		timing = &parsed
+	}
+
+	// Conditional fetch: skip the payload if the client's hash is current.
+	// The hash is that of the bytes just parsed, so it always matches the
+	// data; historical fetches carry none.
+	clientHash, conditional := ifNoneMatch(ctx)
+	conditional = conditional && !historical
+	etag := s.config.etag && !historical
+	var hash string
+	if timing != nil {
+		hash = timing.hash
+	}
+	variant := etagVariant(ctx, req.Path)
+	if conditional && matchesClient(clientHash, hash, variant) {
+		value := notModifiedStruct(hash)
+		if etag {
+			setETag(ctx, value, hash, variant)
+		}
+		return &providerv1.FetchResponse{Value: value}, nil
+	}
+
+	// Navigate to nested path if provided, beneath fetch_root
+	data, err = s.navigate(data, s.scopedKeys(target.filePath, target.keys), req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A trailing "*" collects the target's children: a map's entries or a
+	// list's elements, returned as-is. Scalars have no children.
+	if target.expand {
+		switch data.(type) {
+		case map[string]any, []any:
+		default:
+			return nil, errAmbiguousWildcard(data)
+		}
+		if projected {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported with a trailing \"*\"", projectionHeader)
+		}
+	}
+
+	if projected {
+		if data, err = s.project(data, projection, req.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if aggregated {
+		if target.expand {
+			data = wildcardValues(data)
+		}
+		if data, err = aggregate(aggregateName, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if data, err = s.config.handleNonFinite(data); err != nil {
+		return nil, err
+	}
+	// Candidates describe the data as read, before any reshaping header
+	var candidates []string
+	if s.config.coercionReport {
+		candidates = coercionCandidates(data)
+	}
+	if sampled {
+		data = sampleValue(data)
+	}
+	if skeleton {
+		data = skeletonValue(data)
+	}
+
+	truncated := false
+	if limited {
+		data, truncated = truncateLists(data, limit)
 	}
 
 	// Convert to protobuf
@@ -301,25 +1002,55 @@ func (s *FileProviderService) Fetch(ctx context.Context, req *providerv1.FetchRe
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to convert data: %v", err)
 	}
+	if truncated {
+		value.Fields[truncatedKey] = structpb.NewBoolValue(true)
+	}
+	value, err = setCanonicalJSON(ctx, value, data)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	if conditional {
+		value.Fields[hashKey] = structpb.NewStringValue(hash)
+	}
+	if etag {
+		setETag(ctx, value, hash, variant)
+	}
+	if s.config.sourceInfo {
+		s.setSource(value, target, timing)
+	}
+	if s.config.coercionReport {
+		setCoercionCandidates(value, candidates)
+	}
 
 	return &providerv1.FetchResponse{Value: value}, nil
 }
 
-func (s *FileProviderService) fetchAllFiles() (map[string]any, error) {
+// fetchAllFiles merges every file whose key starts with prefix, in sorted key
+// order. An empty prefix selects all files. Blob files are not merged.
+func (s *FileProviderService) fetchAllFiles(prefix string) (map[string]any, error) {
 	baseNames := make([]string, 0, len(s.config.cslFiles))
-	for baseName := range s.config.cslFiles {
-		baseNames = append(baseNames, baseName)
+	for baseName, filePath := range s.config.cslFiles {
+		if strings.HasPrefix(baseName, prefix) && isCSLFile(filePath) {
+			baseNames = append(baseNames, baseName)
+		}
 	}
 	sort.Strings(baseNames)
 
 	merged := make(map[string]any)
 	for _, baseName := range baseNames {
 		filePath := s.config.cslFiles[baseName]
-		data, err := parseCSLFile(filePath)
+		data, err := s.loadFile(filePath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse file %q: %w", baseName, err)
 		}
 
+		// Files without fetch_root contribute nothing
+		data, ok := lookupPath(data, s.config.fetchRoot)
+		if !ok {
+			continue
+		}
+
 		dataMap, ok := data.(map[string]any)
 		if !ok {
 			return nil, fmt.Errorf("file %q did not return a map", baseName)
@@ -340,14 +1071,11 @@ func deepMergeMaps(dst, src map[string]any) map[string]any {
 		}
 
 		dstValue, exists := dst[key]
-		if !exists {
-			dst[key] = srcMap
-			continue
-		}
-
 		dstMap, ok := dstValue.(map[string]any)
-		if !ok {
-			dst[key] = srcMap
+		if !exists || !ok {
+			// Copy rather than alias srcMap: later merges mutate dst, and
+			// src may be shared with the parse cache.
+			dst[key] = deepMergeMaps(make(map[string]any, len(srcMap)), srcMap)
 			continue
 		}
 
@@ -358,28 +1086,62 @@ func deepMergeMaps(dst, src map[string]any) map[string]any {
 }
 
 // Info returns provider metadata.
+//
+// The alias is only reported once the provider has been initialized. The
+// InfoResponse has no room for free-form metadata, so the effective
+// configuration is exposed through the "__config__" control path instead.
 func (s *FileProviderService) Info(ctx context.Context, req *providerv1.InfoRequest) (*providerv1.InfoResponse, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return &providerv1.InfoResponse{
+	resp := &providerv1.InfoResponse{
 		Version: s.version,
 		Type:    s.providerType,
-	}, nil
+	}
+	if s.config != nil && s.config.initialized {
+		resp.Alias = s.config.alias
+	}
+
+	return resp, nil
 }
 
-// Health checks provider health.
-func (s *FileProviderService) Health(ctx context.Context, req *providerv1.HealthRequest) (*providerv1.HealthResponse, error) {
+// EffectiveConfig returns the resolved configuration currently in effect,
+// or nil if the provider has not been initialized.
+func (s *FileProviderService) EffectiveConfig() map[string]any {
 	s.mu.RLock()
-	initialized := s.config != nil && s.config.initialized
-	s.mu.RUnlock()
+	defer s.mu.RUnlock()
+
+	if s.config == nil || !s.config.initialized {
+		return nil
+	}
+
+	return s.config.effective()
+}
+
+// Health checks provider health. A request with the "deep: true" metadata
+// header also parses every file and reports each one's status (see
+// health.go).
+func (s *FileProviderService) Health(ctx context.Context, req *providerv1.HealthRequest) (*providerv1.HealthResponse, error) {
+	deep, err := boolHeader(ctx, deepHealthHeader)
+	if err != nil {
+		return nil, err
+	}
 
-	if !initialized {
+	s.mu.RLock()
+	config := s.config
+	if config == nil || !config.initialized {
+		s.mu.RUnlock()
 		return &providerv1.HealthResponse{
 			Status:  providerv1.HealthResponse_STATUS_DEGRADED,
 			Message: "not initialized",
 		}, nil
 	}
+	cslFiles := config.cslFiles
+	s.mu.RUnlock()
+
+	if deep {
+		return s.deepHealth(ctx, config, cslFiles)
+	}
 
 	return &providerv1.HealthResponse{
 		Status:  providerv1.HealthResponse_STATUS_OK,
@@ -392,16 +1154,180 @@ func (s *FileProviderService) Shutdown(ctx context.Context, req *providerv1.Shut
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.stopPolling()
 	s.config = nil
+	s.ready = make(chan struct{})
 
 	return &providerv1.ShutdownResponse{}, nil
 }
 
+// parseFile parses a .csl file using the configured conversion options.
+//
+// Results, including parse and conversion errors, are served from the parse
+// cache while the file's modtime and size are unchanged, so a malformed file
+// is not re-read on every fetch. Read failures are not cached. Cached data is
+// shared and must not be mutated.
+func (s *FileProviderService) parseFile(filePath string) (any, error) {
+	data, _, err := s.parseFileTimed(filePath)
+	return data, err
+}
+
+// parseTiming describes how a parse result was obtained: how long decoding
+// the file took when it was parsed, and whether this call was served from the
+// parse cache instead (in which case duration is that of the original parse).
+// hash is the hex SHA-256 of the bytes that were parsed, so it always
+// describes the data it accompanies.
+type parseTiming struct {
+	duration time.Duration
+	cacheHit bool
+	hash     string
+}
+
+// parseFileTimed is parseFile, also reporting its parseTiming.
+func (s *FileProviderService) parseFileTimed(filePath string) (any, parseTiming, error) {
+	return s.parseFileWith(s.config, filePath)
+}
+
+// parseFileWith is parseFileTimed using config rather than s.config, for
+// callers that parse after releasing s.mu (see deepHealth).
+func (s *FileProviderService) parseFileWith(config *providerConfig, filePath string) (any, parseTiming, error) {
+	cache := config.cache
+	if cache == nil {
+		return s.readAndParse(config, filePath)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, parseTiming{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if entry, ok := cache.get(filePath, info.ModTime(), info.Size()); ok {
+		s.metrics.cacheHits.Add(1)
+		s.tracef("parse cache hit: %s", filePath)
+		timing := entry.timing
+		timing.cacheHit = true
+		return entry.data, timing, entry.err
+	}
+
+	s.metrics.cacheMisses.Add(1)
+	s.tracef("parse cache miss: %s", filePath)
+
+	if err := config.checkBlobSize(filePath, info.Size()); err != nil {
+		cache.put(filePath, info.ModTime(), info.Size(), parseTiming{}, nil, err)
+		return nil, parseTiming{}, err
+	}
+
+	content, err := s.readFile(filePath)
+	if err != nil {
+		return nil, parseTiming{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	data, timing, err := s.timedDecode(config, content, filePath)
+	cache.put(filePath, info.ModTime(), info.Size(), timing, data, err)
+	return data, timing, err
+}
+
+// readAndParse reads and parses a file without consulting the cache.
+func (s *FileProviderService) readAndParse(config *providerConfig, filePath string) (any, parseTiming, error) {
+	if !isCSLFile(filePath) {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, parseTiming{}, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if err := config.checkBlobSize(filePath, info.Size()); err != nil {
+			return nil, parseTiming{}, err
+		}
+	}
+
+	content, err := s.readFile(filePath)
+	if err != nil {
+		return nil, parseTiming{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	return s.timedDecode(config, content, filePath)
+}
+
+// timedDecode is decode, also measuring how long it took and hashing content.
+func (s *FileProviderService) timedDecode(config *providerConfig, content []byte, filePath string) (any, parseTiming, error) {
+	start := time.Now()
+	data, err := s.decode(config, content, filePath)
+	sum := sha256.Sum256(content)
+	return data, parseTiming{duration: time.Since(start), hash: hex.EncodeToString(sum[:])}, err
+}
+
+// decode decodes a file's content, recording successful results as
+// snapshots when snapshot_depth is configured.
+func (s *FileProviderService) decode(config *providerConfig, content []byte, filePath string) (any, error) {
+	data, err := config.decodeFile(content, filePath)
+	if err == nil && config.snapshots != nil {
+		config.snapshots.record(filePath, content, data)
+	}
+	return data, err
+}
+
+// parseStatus maps a parse or conversion failure to a gRPC status. Files that
+// exceed the conversion limits are reported as ResourceExhausted, and files
+// lacking a strict active_variant as NotFound.
+func parseStatus(msg string, err error) error {
+	if errors.Is(err, errLimitExceeded) {
+		return status.Errorf(codes.ResourceExhausted, "%s: %v", msg, err)
+	}
+	if errors.Is(err, errImportCycle) {
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	}
+	if errors.Is(err, errVariantNotFound) {
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
+
 // toProtoStruct converts a Go value to a protobuf Struct.
+//
+// Non-map values are wrapped as {"value": v}. When conversion fails, the
+// error names the dotted key path and Go type of the first offending value.
 func toProtoStruct(v any) (*structpb.Struct, error) {
-	if m, ok := v.(map[string]any); ok {
-		return structpb.NewStruct(m)
+	m, ok := v.(map[string]any)
+	if !ok {
+		m = map[string]any{valueWrapperKey: v}
+	}
+
+	result, err := structpb.NewStruct(m)
+	if err != nil {
+		if path, value, found := unsupportedValue(m, nil); found {
+			return nil, fmt.Errorf("value at %q has unsupported type %T: %w", strings.Join(path, "."), value, err)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// unsupportedValue finds the first value (in sorted key order) that structpb
+// cannot represent, returning its key path; list elements contribute their
+// index.
+func unsupportedValue(v any, path []string) ([]string, any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if p, value, found := unsupportedValue(v[key], append(path, key)); found {
+				return p, value, true
+			}
+		}
+		return nil, nil, false
+	case []any:
+		for i, elem := range v {
+			if p, value, found := unsupportedValue(elem, append(path, strconv.Itoa(i))); found {
+				return p, value, true
+			}
+		}
+		return nil, nil, false
+	default:
+		if _, err := structpb.NewValue(v); err != nil {
+			return append([]string{}, path...), v, true
+		}
+		return nil, nil, false
 	}
-	wrapped := map[string]any{"value": v}
-	return structpb.NewStruct(wrapped)
 }
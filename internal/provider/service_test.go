@@ -1,14 +1,29 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
@@ -294,6 +309,82 @@ func TestHealth(t *testing.T) {
 	}
 }
 
+func TestHealth_Deep(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"api.csl":    "app:\n  name: api\n",
+		"worker.csl": "app:\n  name: worker\n",
+		"broken.csl": "app:\n  name: x\n---\n",
+	}, nil)
+
+	// The shallow check does not look at files
+	resp, err := svc.Health(context.Background(), &providerv1.HealthRequest{})
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if resp.Status != providerv1.HealthResponse_STATUS_OK {
+		t.Errorf("Expected shallow OK, got %v", resp.Status)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(deepHealthHeader, "true"))
+	resp, err = svc.Health(ctx, &providerv1.HealthRequest{})
+	if err != nil {
+		t.Fatalf("Deep health failed: %v", err)
+	}
+	if resp.Status != providerv1.HealthResponse_STATUS_DEGRADED {
+		t.Errorf("Expected DEGRADED with a broken file, got %v", resp.Status)
+	}
+
+	var report deepHealthReport
+	if err := json.Unmarshal([]byte(resp.Message), &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %q: %v", resp.Message, err)
+	}
+	if report.Files["api"] != "ok" || report.Files["worker"] != "ok" {
+		t.Errorf("Expected api and worker ok, got %v", report.Files)
+	}
+	if !strings.HasPrefix(report.Files["broken"], "error: ") {
+		t.Errorf("Expected broken to be reported as errored, got %q", report.Files["broken"])
+	}
+	if report.Checked != 3 || report.Total != 3 {
+		t.Errorf("Expected 3 of 3 files checked, got %d of %d", report.Checked, report.Total)
+	}
+}
+
+func TestHealth_DeepDoesNotBlockReload(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"api.csl": "app:\n  name: api\n"}, nil)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	svc.readFile = func(name string) ([]byte, error) {
+		close(started)
+		<-release
+		return os.ReadFile(name)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(deepHealthHeader, "true"))
+		_, err := svc.Health(ctx, &providerv1.HealthRequest{})
+		done <- err
+	}()
+	<-started
+
+	// The deep check is parsing; a reload must not wait for it
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- svc.Reload(context.Background()) }()
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Errorf("Reload failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Reload blocked on a deep health check")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Deep health failed: %v", err)
+	}
+}
+
 func TestInfo(t *testing.T) {
 	svc := NewFileProviderService("0.1.0", "file")
 
@@ -369,6 +460,18 @@ func TestInit_EmptyDirectory(t *testing.T) {
 	}
 }
 
+func TestInit_NilConfig(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "config is required") {
+		t.Errorf("Expected 'config is required', got %v", err)
+	}
+}
+
 func TestInit_EmptyAlias(t *testing.T) {
 	svc := NewFileProviderService("0.1.0", "file")
 
@@ -584,3 +687,2382 @@ func TestFetch_TrailingStarScalar(t *testing.T) {
 		t.Errorf("Expected InvalidArgument, got %v", st.Code())
 	}
 }
+
+func TestFetch_TrailingStarMapVsList(t *testing.T) {
+	content := "database:\n  host: db.local\n  replicas:\n    - r1\n    - r2\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database", "*"}})
+	if err != nil {
+		t.Fatalf("Fetch map wildcard failed: %v", err)
+	}
+	plain, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database"}})
+	if err != nil {
+		t.Fatalf("Fetch map failed: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Value.AsMap(), plain.Value.AsMap()) {
+		t.Errorf("map wildcard = %v, want the map's entries %v", resp.Value.AsMap(), plain.Value.AsMap())
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database", "replicas", "*"}})
+	if err != nil {
+		t.Fatalf("Fetch list wildcard failed: %v", err)
+	}
+	want := []any{"r1", "r2"}
+	if got := resp.Value.AsMap()["value"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("list wildcard = %v, want %v", got, want)
+	}
+}
+
+func TestFetch_NonFiniteNumbers(t *testing.T) {
+	// A sum aggregate overflowing float64 yields +Inf
+	content := "pool:\n  weights:\n    - 1e308\n    - 1e308\n"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(aggregateHeader, "sum"))
+
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+	_, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "pool", "weights"}})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "not a finite number (+Inf)") {
+		t.Errorf("Expected InvalidArgument naming +Inf, got %v", err)
+	}
+
+	svc, _ = newInitializedService(t, map[string]string{"config.csl": content}, map[string]any{"non_finite_numbers": "string"})
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "pool", "weights"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "+Inf" {
+		t.Errorf("Expected sentinel \"+Inf\", got %v", got)
+	}
+}
+
+func TestHandleNonFinite(t *testing.T) {
+	data := map[string]any{
+		"ok":    1.5,
+		"stats": map[string]any{"ratios": []any{0.5, math.NaN(), math.Inf(-1)}},
+	}
+
+	_, err := (&providerConfig{nonFiniteNumbers: nonFiniteError}).handleNonFinite(data)
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), `"stats.ratios.1"`) {
+		t.Errorf("Expected InvalidArgument naming stats.ratios.1, got %v", err)
+	}
+
+	got, err := (&providerConfig{nonFiniteNumbers: nonFiniteString}).handleNonFinite(data)
+	if err != nil {
+		t.Fatalf("handleNonFinite failed: %v", err)
+	}
+	want := map[string]any{
+		"ok":    1.5,
+		"stats": map[string]any{"ratios": []any{0.5, "NaN", "-Inf"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if ratios := data["stats"].(map[string]any)["ratios"].([]any); !math.IsNaN(ratios[1].(float64)) {
+		t.Error("Expected the input to be left unmodified")
+	}
+}
+
+func TestWildcardValues_MapKeySorted(t *testing.T) {
+	data := map[string]any{"c": "3", "a": "1", "e": "5", "b": "2", "d": "4"}
+	want := []any{"1", "2", "3", "4", "5"}
+
+	for i := 0; i < 20; i++ {
+		if got := wildcardValues(data); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: expected %v, got %v", i, want, got)
+		}
+	}
+
+	list := []any{"3", "1", "2"}
+	if got := wildcardValues(list); !reflect.DeepEqual(got, list) {
+		t.Errorf("Expected list order %v preserved, got %v", list, got)
+	}
+}
+
+func TestFetch_AggregateWildcardOverMap(t *testing.T) {
+	content := "pool:\n  weights:\n    b: 0.2\n    a: 0.1\n    c: 0.3\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(aggregateHeader, "sum"))
+	path := []string{"config", "pool", "weights", "*"}
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: path})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	// Key order a, b, c: (0.1 + 0.2) + 0.3, computed at run time
+	a, b, c := 0.1, 0.2, 0.3
+	if got, want := resp.Value.AsMap()["value"], a+b+c; got != want {
+		t.Errorf("Expected sum %v, got %v", want, got)
+	}
+
+	// Without the wildcard the map is not a list
+	_, err = svc.Fetch(ctx, &providerv1.FetchRequest{Path: path[:3]})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument aggregating a map, got %v", err)
+	}
+}
+
+func TestInit_WorkDirOverride(t *testing.T) {
+	workDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(workDir, "configs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "configs", "config.csl"), []byte("app:\n  name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(WorkDirEnvVar, workDir)
+
+	svc := NewFileProviderService("0.1.0", "file")
+	config, _ := structpb.NewStruct(map[string]any{"directory": "configs"})
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if got, want := svc.config.directory, filepath.Join(workDir, "configs"); got != want {
+		t.Errorf("Expected directory %q, got %q", want, got)
+	}
+
+	// A source file path still takes precedence
+	sourceDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(sourceDir, "configs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "configs", "other.csl"), []byte("app:\n  name: other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req := &providerv1.InitRequest{Alias: "test", Config: config, SourceFilePath: filepath.Join(sourceDir, "main.csl")}
+	if _, err := svc.Init(context.Background(), req); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if got, want := svc.config.directory, filepath.Join(sourceDir, "configs"); got != want {
+		t.Errorf("Expected directory %q, got %q", want, got)
+	}
+}
+
+func TestFetch_EmptySectionIsEmptyStruct(t *testing.T) {
+	content := "empty:\napp:\n  name: test\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "empty"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if fields := resp.Value.GetFields(); len(fields) != 0 {
+		t.Errorf("Expected an empty struct, got %v", fields)
+	}
+
+	_, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "missing"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an undeclared section, got %v", err)
+	}
+}
+
+// newInitializedService writes files (base name -> content) into a temporary
+// directory and initializes a service against it with the given extra config.
+func newInitializedService(t *testing.T, files map[string]string, extra map[string]any) (*FileProviderService, string) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configMap := map[string]any{"directory": tmpDir}
+	for key, value := range extra {
+		configMap[key] = value
+	}
+
+	config, err := structpb.NewStruct(configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewFileProviderService("0.1.0", "file")
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	return svc, tmpDir
+}
+
+func TestInit_JailToRootSkipsEscapingSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.csl"), []byte("app:\n  name: secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("app:\n  name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.csl"), filepath.Join(tmpDir, "secret.csl")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "config.csl"), filepath.Join(tmpDir, "alias.csl")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		extra      map[string]any
+		wantSecret codes.Code
+	}{
+		{name: "default", wantSecret: codes.NotFound},
+		{name: "lazy scan", extra: map[string]any{"lazy_scan": true}, wantSecret: codes.NotFound},
+		{name: "jail disabled", extra: map[string]any{"jail_to_root": false}, wantSecret: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configMap := map[string]any{"directory": tmpDir}
+			for key, value := range tt.extra {
+				configMap[key] = value
+			}
+			config, err := structpb.NewStruct(configMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			svc := NewFileProviderService("0.1.0", "file")
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			_, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"secret", "app", "name"}})
+			if status.Code(err) != tt.wantSecret {
+				t.Errorf("Expected %v fetching the escaping symlink, got %v", tt.wantSecret, err)
+			}
+
+			// A symlink that stays within the directory is still served
+			if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"alias", "app", "name"}}); err != nil {
+				t.Errorf("Fetch through in-root symlink failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetch_Roots(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirA, "database.csl"), []byte("db:\n  host: a.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirB, "database.csl"), []byte("db:\n  host: b.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"roots": map[string]any{
+			"tenantA": dirA,
+			"tenantB": dirB,
+		},
+	})
+
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	for tenant, want := range map[string]string{"tenantA": "a.local", "tenantB": "b.local"} {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{
+			Path: []string{tenant, "database", "db", "host"},
+		})
+		if err != nil {
+			t.Fatalf("Fetch for %s failed: %v", tenant, err)
+		}
+
+		if got := resp.Value.AsMap()["value"]; got != want {
+			t.Errorf("Expected %s host %q, got %v", tenant, want, got)
+		}
+	}
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"tenantC", "database"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown root, got %v", err)
+	}
+}
+
+func TestInit_RootsAndDirectoryExclusive(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	tmpDir := t.TempDir()
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory": tmpDir,
+		"roots":     map[string]any{"tenantA": tmpDir},
+	})
+
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestInit_Timeout(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	// Simulate a hung network mount: the directory read never returns until
+	// the test finishes.
+	release := make(chan struct{})
+	defer close(release)
+	svc.readDir = func(name string) ([]os.DirEntry, error) {
+		<-release
+		return nil, nil
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory":    t.TempDir(),
+		"init_timeout": "50ms",
+	})
+
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	if svc.config != nil {
+		t.Error("Expected config to remain unset after a timed out Init")
+	}
+}
+
+func TestInit_InvalidTimeout(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory":    t.TempDir(),
+		"init_timeout": "soon",
+	})
+
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestFetch_ReferenceFormats(t *testing.T) {
+	files := map[string]string{"app.csl": "app:\n  cidr: @network:vpc.cidr\n"}
+
+	tests := []struct {
+		name   string
+		config map[string]any
+		want   any
+	}{
+		{"default is string", nil, "reference:network:vpc.cidr"},
+		{"explicit string", map[string]any{"ref_format": "string"}, "reference:network:vpc.cidr"},
+		{"struct", map[string]any{"ref_format": "struct"}, map[string]any{
+			"__ref__": map[string]any{"alias": "network", "path": []any{"vpc", "cidr"}},
+		}},
+		{"string with alias prefix", map[string]any{"ref_alias_prefix": "files."}, "reference:files.network:vpc.cidr"},
+		{"struct with alias prefix", map[string]any{"ref_format": "struct", "ref_alias_prefix": "files."}, map[string]any{
+			"__ref__": map[string]any{"alias": "files.network", "path": []any{"vpc", "cidr"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newInitializedService(t, files, tt.config)
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+
+			if got := resp.Value.AsMap()["cidr"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFetch_FollowReferencesWithAliasPrefix(t *testing.T) {
+	files := map[string]string{
+		"database.csl": "db:\n  primary:\n    host: db.local\n",
+		"app.csl":      "app:\n  db: @test:database.db.primary\n",
+	}
+	svc, _ := newInitializedService(t, files, map[string]any{"follow_references": true, "ref_alias_prefix": "files."})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app", "db", "host"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "db.local" {
+		t.Errorf("Expected 'db.local' through the prefixed reference, got %v", got)
+	}
+}
+
+func TestFetch_FollowReferences(t *testing.T) {
+	files := map[string]string{
+		"database.csl": "db:\n  primary:\n    host: db.local\n",
+		"app.csl":      "app:\n  db: @test:database.db.primary\n",
+	}
+
+	for _, refFormat := range []string{refFormatString, refFormatStruct} {
+		t.Run(refFormat, func(t *testing.T) {
+			svc, _ := newInitializedService(t, files, map[string]any{"follow_references": true, "ref_format": refFormat})
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app", "db", "host"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if got := resp.Value.AsMap()["value"]; got != "db.local" {
+				t.Errorf("Expected 'db.local' through the reference, got %v", got)
+			}
+		})
+	}
+}
+
+func TestFetch_ReferenceBlockedWithoutFollow(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"database.csl": "db:\n  primary:\n    host: db.local\n",
+		"app.csl":      "app:\n  db: @test:database.db.primary\n",
+	}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app", "db", "host"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "is a reference to @test:database.db.primary; set follow_references") {
+		t.Errorf("Expected a blocked-reference explanation, got %v", err)
+	}
+
+	// The reference itself is still returned as a placeholder
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app", "db"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "reference:test:database.db.primary" {
+		t.Errorf("Expected the reference placeholder, got %v", got)
+	}
+}
+
+func TestFetch_FollowReferencesCycle(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"a.csl": "x:\n  next: @test:b.y.next\n",
+		"b.csl": "y:\n  next: @test:a.x.next\n",
+	}, map[string]any{"follow_references": true})
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"a", "x", "next", "key"}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a reference cycle, got %v", err)
+	}
+}
+
+func TestFetch_StructuredReferenceTargetFile(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"database.csl": "db:\n  host: localhost\n",
+		"app.csl":      "app:\n  db_host: @test:database.db.host\n  cidr: @network:vpc.cidr\n",
+	}, map[string]any{"ref_format": "struct"})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+
+	intra := data["db_host"].(map[string]any)["__ref__"].(map[string]any)
+	if intra["alias"] != "test" {
+		t.Errorf("Expected alias 'test', got %v", intra["alias"])
+	}
+	if want := filepath.Join(tmpDir, "database.csl"); intra["target_file"] != want {
+		t.Errorf("Expected target_file %q, got %v", want, intra["target_file"])
+	}
+
+	external := data["cidr"].(map[string]any)["__ref__"].(map[string]any)
+	if _, ok := external["target_file"]; ok {
+		t.Errorf("Expected no target_file for a reference to another provider, got %v", external["target_file"])
+	}
+}
+
+func TestFetch_TraceMode(t *testing.T) {
+	t.Setenv("NOMOS_PROVIDER_TRACE", "1")
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	svc, tmpDir := newInitializedService(t, map[string]string{
+		"database.csl": "connection:\n  host: localhost\n",
+	}, nil)
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{
+		Path: []string{"database", "connection", "host"},
+	}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		"resolved file \"database\" to " + filepath.Join(tmpDir, "database.csl"),
+		"step 1 key \"connection\" -> map[string]interface {}",
+		"step 2 key \"host\" -> string",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected trace log to contain %q, got:\n%s", want, logs)
+		}
+	}
+}
+
+func TestFetch_TraceLogsPeer(t *testing.T) {
+	t.Setenv("NOMOS_PROVIDER_TRACE", "1")
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	addr := &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 40000}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	if _, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	// Without peer info the fetch still succeeds
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{`fetch ["config"]: peer=10.1.2.3:40000`, `fetch ["config"]: peer=unknown`} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected trace log to contain %q, got:\n%s", want, logs)
+		}
+	}
+}
+
+func TestFetch_NotInitializedReason(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", st.Code())
+	}
+	if !strings.Contains(st.Message(), "call Init") {
+		t.Errorf("Expected guidance to call Init, got %q", st.Message())
+	}
+
+	var reason string
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			reason = info.Reason
+		}
+	}
+	if reason != "PROVIDER_NOT_INITIALIZED" {
+		t.Errorf("Expected reason PROVIDER_NOT_INITIALIZED, got %q", reason)
+	}
+}
+
+func TestFetch_WildcardOnScalarReason(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name", "*"}})
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", st.Code())
+	}
+	if !strings.Contains(st.Message(), "only be applied to a map or list") {
+		t.Errorf("Expected an explanation of wildcard targets, got %q", st.Message())
+	}
+
+	var info *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		if i, ok := detail.(*errdetails.ErrorInfo); ok {
+			info = i
+		}
+	}
+	if info == nil || info.Reason != "AMBIGUOUS_WILDCARD" {
+		t.Fatalf("Expected reason AMBIGUOUS_WILDCARD, got %v", info)
+	}
+	if info.Metadata["type"] != "string" {
+		t.Errorf("Expected type metadata %q, got %q", "string", info.Metadata["type"])
+	}
+}
+
+func TestFetch_KeyStyleAcceptsBothForms(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "env", "dev.csl"), []byte("app:\n  name: dev\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, style := range []string{keyStylePath, keyStyleDotted, ""} {
+		t.Run(style, func(t *testing.T) {
+			configMap := map[string]any{"directory": tmpDir, "recursive": true}
+			if style != "" {
+				configMap["key_style"] = style
+			}
+			config, _ := structpb.NewStruct(configMap)
+
+			svc := NewFileProviderService("0.1.0", "file")
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			wantKey := "env/dev"
+			if style == keyStyleDotted {
+				wantKey = "env.dev"
+			}
+			if _, ok := svc.config.cslFiles[wantKey]; !ok {
+				t.Errorf("Expected file keyed %q, got %v", wantKey, svc.config.cslFiles)
+			}
+
+			for _, key := range []string{"env/dev", "env.dev"} {
+				resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{key, "app", "name"}})
+				if err != nil {
+					t.Fatalf("Fetch %q failed: %v", key, err)
+				}
+				if got := resp.Value.AsMap()["value"]; got != "dev" {
+					t.Errorf("Fetch %q: expected dev, got %v", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFetch_KeepExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("app:\n  name: root\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "env", "dev.csl"), []byte("app:\n  name: dev\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%v", lazy), func(t *testing.T) {
+			config, _ := structpb.NewStruct(map[string]any{
+				"directory":      tmpDir,
+				"recursive":      true,
+				"keep_extension": true,
+				"lazy_scan":      lazy,
+			})
+			svc := NewFileProviderService("0.1.0", "file")
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			for key, want := range map[string]string{"config.csl": "root", "env/dev.csl": "dev"} {
+				resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{key, "app", "name"}})
+				if err != nil {
+					t.Fatalf("Fetch %q failed: %v", key, err)
+				}
+				if got := resp.Value.AsMap()["value"]; got != want {
+					t.Errorf("Fetch %q: expected %s, got %v", key, want, got)
+				}
+			}
+
+			_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app"}})
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("Expected NotFound for the trimmed name, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInit_OverlayDirNested(t *testing.T) {
+	baseDir := t.TempDir()
+	overlayDir := filepath.Join(baseDir, "overlay")
+	if err := os.Mkdir(overlayDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, filePath := range []string{filepath.Join(baseDir, "database.csl"), filepath.Join(overlayDir, "database.csl")} {
+		if err := os.WriteFile(filePath, []byte("db:\n  host: local\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		config     map[string]any
+		sourceFile string
+	}{
+		{"overlay inside base", map[string]any{"base_dir": baseDir, "overlay_dir": overlayDir}, ""},
+		{"base inside overlay", map[string]any{"base_dir": overlayDir, "overlay_dir": baseDir}, ""},
+		// Only nested once resolved against the source file's directory
+		{"relative overlay inside base", map[string]any{"base_dir": baseDir, "overlay_dir": "./overlay"}, filepath.Join(baseDir, "main.csl")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, _ := structpb.NewStruct(tt.config)
+			_, err := NewFileProviderService("0.1.0", "file").Init(context.Background(),
+				&providerv1.InitRequest{Alias: "test", Config: config, SourceFilePath: tt.sourceFile})
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "must not be nested") {
+				t.Errorf("Expected InvalidArgument for nested layers, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetch_OverlayDir(t *testing.T) {
+	baseDir := t.TempDir()
+	overlayDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(baseDir, "database.csl"):    "db:\n  host: base.local\n",
+		filepath.Join(baseDir, "network.csl"):     "net:\n  cidr: 10.0.0.0/8\n",
+		filepath.Join(overlayDir, "database.csl"): "db:\n  host: overlay.local\n",
+	}
+	for filePath, content := range files {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{"base_dir": baseDir, "overlay_dir": overlayDir, "source_info": true})
+	svc := NewFileProviderService("0.1.0", "file")
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	tests := []struct {
+		path      []string
+		key       string
+		wantValue string
+		wantDir   string
+		wantLayer string
+	}{
+		{path: []string{"database", "db"}, key: "host", wantValue: "overlay.local", wantDir: overlayDir, wantLayer: "overlay"},
+		{path: []string{"network", "net"}, key: "cidr", wantValue: "10.0.0.0/8", wantDir: baseDir, wantLayer: "base"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path[0], func(t *testing.T) {
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+
+			got := resp.Value.AsMap()
+			if got[tt.key] != tt.wantValue {
+				t.Errorf("Expected %s %q, got %v", tt.key, tt.wantValue, got[tt.key])
+			}
+			source, _ := got[sourceKey].(map[string]any)
+			if source["directory"] != tt.wantDir || source["layer"] != tt.wantLayer {
+				t.Errorf("Expected source in %s from layer %s, got %v", tt.wantDir, tt.wantLayer, source)
+			}
+		})
+	}
+}
+
+func TestFetch_CompatVersionLegacyStrings(t *testing.T) {
+	files := map[string]string{"app.csl": "app:\n  port: 8080\n  timeout: 30s\n  memory: 512mb\n  cidr: @network:vpc.cidr\n"}
+	svc, _ := newInitializedService(t, files, map[string]any{"compat_version": "0.2"})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"app", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]any{
+		"port":    "8080",
+		"timeout": "30s",
+		"memory":  "512mb",
+		"cidr":    "reference:network:vpc.cidr",
+	}
+	if got := resp.Value.AsMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected legacy string output %v, got %v", want, got)
+	}
+
+	// Options that change the shape cannot be enabled alongside it
+	for _, key := range []string{"typed_values", "normalize_units"} {
+		config, _ := structpb.NewStruct(map[string]any{"directory": t.TempDir(), "compat_version": "0.2", key: true})
+		_, err := NewFileProviderService("0.1.0", "file").Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %s with compat_version 0.2, got %v", key, err)
+		}
+	}
+}
+
+func TestFetch_Sample(t *testing.T) {
+	content := "app:\n  name: api\n  port: 8080\n  ratio: 0.5\n  debug: true\n  db: @network:vpc.cidr\n  hosts:\n    - a.example.com\n    - b.example.com\n  limits:\n    cpu: 2\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(sampleHeader, "true"))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]any{
+		"name":   "",
+		"port":   float64(0),
+		"ratio":  float64(0),
+		"debug":  false,
+		"db":     "",
+		"hosts":  []any{"", ""},
+		"limits": map[string]any{"cpu": float64(0)},
+	}
+	if got := resp.Value.AsMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected sample %v, got %v", want, got)
+	}
+
+	// The sample leaves the cached data intact
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "api" {
+		t.Errorf("Expected real data after a sample, got %v", got)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(sampleHeader, "maybe"))
+	if _, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a non-boolean sample header, got %v", err)
+	}
+}
+
+func TestFetch_Skeleton(t *testing.T) {
+	content := "app:\n  name: api\n  port: 8080\n  debug: true\n  cidr: @network:vpc.cidr\n  hosts:\n    - a.example.com\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(skeletonHeader, "true"))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]any{
+		"name":  "string",
+		"port":  "number",
+		"debug": "bool",
+		"cidr": map[string]any{"__ref__": map[string]any{
+			"alias": "network",
+			"path":  []any{"vpc", "cidr"},
+		}},
+		"hosts": []any{"string"},
+	}
+	if got := resp.Value.AsMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected skeleton %v, got %v", want, got)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(skeletonHeader, "true", sampleHeader, "true"))
+	if _, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for sample with skeleton, got %v", err)
+	}
+}
+
+func TestFetch_Projection(t *testing.T) {
+	content := "app:\n  database:\n    host: db.local\n    port: 5432\n    user: admin\n  name: api\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(projectionHeader, "{host: database.host, port: database.port}"))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	want := map[string]any{"host": "db.local", "port": "5432"}
+	if got := resp.Value.AsMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected projection %v, got %v", want, got)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		want codes.Code
+	}{
+		{name: "missing field", spec: "host: database.missing", want: codes.NotFound},
+		{name: "malformed entry", spec: "{host}", want: codes.InvalidArgument},
+		{name: "duplicate name", spec: "a: name, a: database.host", want: codes.InvalidArgument},
+		{name: "empty segment", spec: "host: database..host", want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(projectionHeader, tt.spec))
+			_, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+			if status.Code(err) != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFetch_ReportCoercionCandidates(t *testing.T) {
+	content := "database:\n  host: db.local\n  port: \"5432\"\n  ssl: \"true\"\n  hosts:\n    - a.local\n    - \"8080\"\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, map[string]any{"report_coercion_candidates": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	got := resp.Value.AsMap()
+	want := []any{"hosts.1", "port", "ssl"}
+	if !reflect.DeepEqual(got[coercionCandidatesKey], want) {
+		t.Errorf("Expected candidates %v, got %v", want, got[coercionCandidatesKey])
+	}
+	if got["port"] != "5432" || got["ssl"] != "true" {
+		t.Errorf("Expected values to stay strings, got %v", got)
+	}
+}
+
+func TestInit_DirectoryIsCleaned(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "env", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"config.csl", "env/dev.csl"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(rel)), []byte("app:\n  name: test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{
+		tmpDir + string(filepath.Separator),
+		filepath.Join(tmpDir, "env") + string(filepath.Separator) + ".." + string(filepath.Separator) + ".",
+		tmpDir + "/env/sub/../../",
+	} {
+		t.Run(dir, func(t *testing.T) {
+			config, _ := structpb.NewStruct(map[string]any{"directory": dir, "recursive": true, "source_info": true})
+			svc := NewFileProviderService("0.1.0", "file")
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			if svc.config.directory != tmpDir {
+				t.Errorf("Expected directory %q, got %q", tmpDir, svc.config.directory)
+			}
+			want := map[string]string{
+				"config":  filepath.Join(tmpDir, "config.csl"),
+				"env/dev": filepath.Join(tmpDir, "env", "dev.csl"),
+			}
+			if !reflect.DeepEqual(svc.config.cslFiles, want) {
+				t.Errorf("Expected files %v, got %v", want, svc.config.cslFiles)
+			}
+
+			resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"env/dev"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			source, _ := resp.Value.AsMap()["__source__"].(map[string]any)
+			if source["directory"] != tmpDir {
+				t.Errorf("Expected source directory %q, got %v", tmpDir, source["directory"])
+			}
+		})
+	}
+}
+
+func TestFetch_DescendValueWrapper(t *testing.T) {
+	files := map[string]string{"config.csl": "app:\n  name: api\n  ports:\n    - 80\n  meta:\n    value: real\n"}
+	svc, _ := newInitializedService(t, files, map[string]any{"descend_value_wrapper": true})
+
+	tests := []struct {
+		path []string
+		want any
+	}{
+		{path: []string{"config", "app", "name", "value"}, want: "api"},
+		{path: []string{"config", "app", "ports", "value"}, want: []any{"80"}},
+		// A real "value" key is looked up as data
+		{path: []string{"config", "app", "meta", "value"}, want: "real"},
+	}
+	for _, tt := range tests {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path})
+		if err != nil {
+			t.Fatalf("Fetch %q failed: %v", tt.path, err)
+		}
+		if got := resp.Value.AsMap()["value"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Fetch %q: expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	// Without the option the wrapper is not part of the data
+	plain, _ := newInitializedService(t, files, nil)
+	_, err := plain.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name", "value"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without descend_value_wrapper, got %v", err)
+	}
+}
+
+func TestFetch_ActiveVariant(t *testing.T) {
+	files := map[string]string{
+		"config.csl": "dev:\n  database:\n    host: dev.local\nprod:\n  database:\n    host: prod.local\n",
+		"other.csl":  "app:\n  name: other\n",
+	}
+	svc, _ := newInitializedService(t, files, map[string]any{"active_variant": "prod"})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "database", "host"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "prod.local" {
+		t.Errorf("Expected the prod variant's host, got %v", got)
+	}
+
+	// A file without the variant is read whole
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"other", "app", "name"}})
+	if err != nil {
+		t.Fatalf("Fetch of a file without variants failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "other" {
+		t.Errorf("Expected other, got %v", got)
+	}
+
+	strict, _ := newInitializedService(t, files, map[string]any{"active_variant": "prod", "strict_variant": true})
+	_, err = strict.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"other", "app", "name"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a file lacking the strict variant, got %v", err)
+	}
+}
+
+func TestFetch_ActiveVariantSkipsBlobs(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "prod:\n  name: prod\n",
+		"cert.pem":   "certificate",
+	}, map[string]any{"active_variant": "prod", "strict_variant": true, "blob_extensions": []any{".pem"}})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"cert.pem"}})
+	if err != nil {
+		t.Fatalf("Expected a blob to be served under strict_variant, got %v", err)
+	}
+	if resp.Value.AsMap()[blobKey] != true {
+		t.Errorf("Expected the blob payload, got %v", resp.Value.AsMap())
+	}
+}
+
+func TestFetch_AmbiguousKeyConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for rel, content := range map[string]string{
+		"env.dev.csl": "app:\n  name: flat\n",
+		"env/dev.csl": "app:\n  name: nested\n",
+		"other.csl":   "app:\n  name: other\n",
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(rel)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "recursive": true})
+	svc := NewFileProviderService("0.1.0", "file")
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// Both forms are ambiguous, whichever the request uses
+	for _, key := range []string{"env.dev", "env/dev"} {
+		_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{key, "app", "name"}})
+
+		st := status.Convert(err)
+		if st.Code() != codes.AlreadyExists {
+			t.Fatalf("%s: expected AlreadyExists, got %v: %v", key, st.Code(), err)
+		}
+
+		var info *errdetails.ErrorInfo
+		for _, detail := range st.Details() {
+			if i, ok := detail.(*errdetails.ErrorInfo); ok {
+				info = i
+			}
+		}
+		if info == nil || info.Reason != "PATH_AMBIGUOUS" {
+			t.Fatalf("%s: expected reason PATH_AMBIGUOUS, got %v", key, info)
+		}
+		want := map[string]string{
+			"file_1": "env.dev.csl",
+			"file_2": "env/dev.csl",
+		}
+		for k, v := range want {
+			if info.Metadata[k] != v {
+				t.Errorf("%s: expected metadata %s=%q, got %q", key, k, v, info.Metadata[k])
+			}
+		}
+		if strings.Contains(err.Error(), tmpDir) {
+			t.Errorf("%s: expected no absolute paths in the error, got %v", key, err)
+		}
+	}
+
+	// Keys that name a single file are unaffected
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"other", "app", "name"}}); err != nil {
+		t.Errorf("Fetch of an unambiguous key failed: %v", err)
+	}
+}
+
+func TestInit_RecursiveInclude(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	tmpDir := t.TempDir()
+	for _, rel := range []string{
+		"services/config.csl",
+		"services/api/config.csl",
+		"services/api/v1/config.csl",
+		"services/api/other.csl",
+		"top.csl",
+	} {
+		full := filepath.Join(tmpDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("app:\n  name: test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory": tmpDir,
+		"recursive": true,
+		"include":   []any{"services/**/config.csl"},
+	})
+
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	want := []string{"services/api/config", "services/api/v1/config", "services/config"}
+	if len(svc.config.cslFiles) != len(want) {
+		t.Fatalf("Expected %d files, got %v", len(want), svc.config.cslFiles)
+	}
+	for _, key := range want {
+		if _, ok := svc.config.cslFiles[key]; !ok {
+			t.Errorf("Expected %q to be enumerated, got %v", key, svc.config.cslFiles)
+		}
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"services/api/v1/config", "app", "name"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resp.Value.AsMap()["value"] != "test" {
+		t.Errorf("Expected 'test', got %v", resp.Value.AsMap()["value"])
+	}
+}
+
+func TestFetch_WaitsForConcurrentInit(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	svc.initWait = 5 * time.Second
+
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("app:\n  name: myapp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type fetchResult struct {
+		resp *providerv1.FetchResponse
+		err  error
+	}
+	done := make(chan fetchResult, 1)
+	go func() {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name"}})
+		done <- fetchResult{resp: resp, err: err}
+	}()
+
+	// Give the Fetch a head start so it arrives before Init.
+	time.Sleep(50 * time.Millisecond)
+
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir})
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	result := <-done
+	if result.err != nil {
+		t.Fatalf("Expected early Fetch to wait for Init, got %v", result.err)
+	}
+	if result.resp.Value.AsMap()["value"] != "myapp" {
+		t.Errorf("Expected 'myapp', got %v", result.resp.Value.AsMap()["value"])
+	}
+}
+
+func TestFetch_WaitForInitTimesOut(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	svc.initWait = 20 * time.Millisecond
+
+	_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition after the wait elapses, got %v", err)
+	}
+}
+
+func TestFetch_ConditionalNotModified(t *testing.T) {
+	content := "app:\n  name: test\n"
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	hash, err := fileHash(filepath.Join(tmpDir, "config.csl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ifNoneMatchHeader, hash))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if data[notModifiedKey] != true || data[hashKey] != hash {
+		t.Errorf("Expected not-modified response with hash %q, got %v", hash, data)
+	}
+	if _, ok := data["name"]; ok {
+		t.Errorf("Expected no payload when not modified, got %v", data)
+	}
+}
+
+func TestFetch_ConditionalModified(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ifNoneMatchHeader, "stale"))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	hash, err := fileHash(filepath.Join(tmpDir, "config.csl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := resp.Value.AsMap()
+	if data["name"] != "test" {
+		t.Errorf("Expected full payload, got %v", data)
+	}
+	if data[hashKey] != hash {
+		t.Errorf("Expected current hash %q, got %v", hash, data[hashKey])
+	}
+	if _, ok := data[notModifiedKey]; ok {
+		t.Errorf("Expected no not-modified flag, got %v", data)
+	}
+}
+
+func TestFetch_ConditionalHashMatchesParsedData(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: one\n"}, nil)
+
+	// The file changes between being read for parsing and any second read
+	parsed := []byte("app:\n  name: two\n")
+	svc.readFile = func(name string) ([]byte, error) {
+		if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("app:\n  name: three\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return parsed, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ifNoneMatchHeader, ""))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	sum := sha256.Sum256(parsed)
+	if data["name"] != "two" || data[hashKey] != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the hash of the parsed content alongside its data, got %v", data)
+	}
+}
+
+func TestFetch_CanonicalJSONIsDeterministic(t *testing.T) {
+	content := "app:\n  zeta: last\n  alpha: first\n  mid:\n    b: 2\n    a: 1\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(canonicalJSONHeader, "true"))
+	fetch := func() string {
+		t.Helper()
+		resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		data := resp.Value.AsMap()
+		if data["alpha"] != "first" {
+			t.Errorf("Expected data alongside canonical JSON, got %v", data)
+		}
+		encoded, _ := data[canonicalJSONKey].(string)
+		return encoded
+	}
+
+	first, second := fetch(), fetch()
+	want := `{"alpha":"first","mid":{"a":"1","b":"2"},"zeta":"last"}`
+	if first != want {
+		t.Errorf("Expected canonical JSON %s, got %s", want, first)
+	}
+	if first != second {
+		t.Errorf("Expected byte-identical canonical JSON, got %s and %s", first, second)
+	}
+}
+
+func TestFetch_CanonicalJSONOnly(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(canonicalJSONHeader, canonicalJSONOnly))
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if len(data) != 1 || data[canonicalJSONKey] != `{"name":"test"}` {
+		t.Errorf("Expected only canonical JSON, got %v", data)
+	}
+}
+
+func TestFetch_ListLimit(t *testing.T) {
+	content := "app:\n  hosts:\n    - a\n    - b\n    - c\n  ports:\n    - 80\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	tests := []struct {
+		name          string
+		limit         string
+		wantHosts     []any
+		wantPorts     []any
+		wantTruncated bool
+	}{
+		{"longer than limit", "2", []any{"a", "b"}, []any{"80"}, true},
+		{"shorter than limit", "5", []any{"a", "b", "c"}, []any{"80"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(listLimitHeader, tt.limit))
+			resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+
+			data := resp.Value.AsMap()
+			if !reflect.DeepEqual(data["hosts"], tt.wantHosts) || !reflect.DeepEqual(data["ports"], tt.wantPorts) {
+				t.Errorf("Expected hosts %v and ports %v, got %v", tt.wantHosts, tt.wantPorts, data)
+			}
+			if _, truncated := data[truncatedKey]; truncated != tt.wantTruncated {
+				t.Errorf("Expected %s present = %v, got %v", truncatedKey, tt.wantTruncated, data)
+			}
+		})
+	}
+
+	// The cached parse result is left intact
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "hosts"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if hosts := resp.Value.AsMap()["value"].([]any); len(hosts) != 3 {
+		t.Errorf("Expected untruncated hosts without a limit, got %v", hosts)
+	}
+}
+
+func TestFetch_InvalidListLimit(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(listLimitHeader, "-1"))
+	_, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestFetch_InheritParentKeys(t *testing.T) {
+	content := "services:\n  timeout: 30s\n  api:\n    port: 8080\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, map[string]any{"inherit_parent_keys": true})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "services", "api"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if data["timeout"] != "30s" || data["port"] != "8080" {
+		t.Errorf("Expected inherited timeout alongside port, got %v", data)
+	}
+}
+
+func TestInit_FileList(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.csl":     "name: config",
+		"env/dev.csl":    "name: dev",
+		"unlisted.csl":   "name: unlisted",
+		"other/away.csl": "name: away",
+	} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := NewFileProviderService("0.1.0", "file")
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory": tmpDir,
+		"file_list": []any{"config.csl", "env/dev.csl", filepath.Join(tmpDir, "other", "away.csl")},
+	})
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	want := map[string]string{
+		"config":  filepath.Join(tmpDir, "config.csl"),
+		"env/dev": filepath.Join(tmpDir, "env", "dev.csl"),
+		"away":    filepath.Join(tmpDir, "other", "away.csl"),
+	}
+	if !reflect.DeepEqual(svc.config.cslFiles, want) {
+		t.Errorf("Expected exactly the listed files %v, got %v", want, svc.config.cslFiles)
+	}
+}
+
+func TestInit_FileListJailedToRoot(t *testing.T) {
+	parent := t.TempDir()
+	tmpDir := filepath.Join(parent, "configs")
+	if err := os.Mkdir(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(tmpDir, "config.csl"), filepath.Join(parent, "outside.csl")} {
+		if err := os.WriteFile(path, []byte("name: test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(parent, "outside.csl"), filepath.Join(tmpDir, "link.csl")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, entry := range []string{filepath.Join(parent, "outside.csl"), "link.csl"} {
+		t.Run(entry, func(t *testing.T) {
+			config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "file_list": []any{"config.csl", entry}})
+			_, err := NewFileProviderService("0.1.0", "file").Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected InvalidArgument for an entry outside the directory, got %v", err)
+			}
+
+			// An explicit opt-out lists it
+			config, _ = structpb.NewStruct(map[string]any{"directory": tmpDir, "file_list": []any{"config.csl", entry}, "jail_to_root": false})
+			if _, err := NewFileProviderService("0.1.0", "file").Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Errorf("Expected Init to succeed with jail_to_root false, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInit_FileListRejectsParentEntries(t *testing.T) {
+	parent := t.TempDir()
+	tmpDir := filepath.Join(parent, "configs")
+	if err := os.Mkdir(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(tmpDir, "config.csl"), filepath.Join(parent, "outside.csl")} {
+		if err := os.WriteFile(path, []byte("name: test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rejected even with jail_to_root false: the key would start with ".."
+	for _, entry := range []string{"../outside.csl", "env/../../outside.csl"} {
+		t.Run(entry, func(t *testing.T) {
+			config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "file_list": []any{"config.csl", entry}, "jail_to_root": false})
+			_, err := NewFileProviderService("0.1.0", "file").Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected InvalidArgument, got %v", err)
+			}
+		})
+	}
+
+	// A ".." that stays inside the directory is fine
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "file_list": []any{"env/../config.csl"}})
+	svc := NewFileProviderService("0.1.0", "file")
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+		t.Errorf("Expected config to be served, got %v", err)
+	}
+}
+
+func TestInit_FileListMissingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("name: test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewFileProviderService("0.1.0", "file")
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory": tmpDir,
+		"file_list": []any{"config.csl", "missing.csl"},
+	})
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"missing.csl"`) {
+		t.Errorf("Expected the missing entry to be named, got %v", err)
+	}
+}
+
+func TestInit_DirectoryIsFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "config.csl")
+	if err := os.WriteFile(filePath, []byte("name: test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]any
+		want   string
+	}{
+		{"plain", nil, "to serve a single file"},
+		{"recursive", map[string]any{"recursive": true}, "recursive scanning requires a directory"},
+		{"lazy_scan", map[string]any{"lazy_scan": true}, "lazy_scan resolves files within a directory"},
+		{"file_list", map[string]any{"file_list": []any{"config.csl"}}, "file_list entries are resolved relative to a directory"},
+		{"file_list wins over recursive", map[string]any{"recursive": true, "file_list": []any{"config.csl"}}, "file_list entries"},
+		{"lazy_scan wins over recursive", map[string]any{"recursive": true, "lazy_scan": true}, "lazy_scan resolves"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := map[string]any{"directory": filePath}
+			for k, v := range tt.config {
+				cfg[k] = v
+			}
+			config, _ := structpb.NewStruct(cfg)
+
+			svc := NewFileProviderService("0.1.0", "file")
+			_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected InvalidArgument, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "path is not a directory: "+filePath) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected not-a-directory error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFetch_Aggregate(t *testing.T) {
+	content := "pool:\n  weights:\n    - 3\n    - 1.5\n    - 4\n  names:\n    - a\n    - b\n"
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": content}, nil)
+
+	tests := []struct {
+		aggregate string
+		want      float64
+	}{
+		{"sum", 8.5},
+		{"count", 3},
+		{"min", 1.5},
+		{"max", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(aggregateHeader, tt.aggregate))
+			resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "pool", "weights"}})
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if got := resp.Value.AsMap()["value"]; got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(aggregateHeader, "sum"))
+	_, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "pool", "names"}})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), `element 0 is not numeric: a`) {
+		t.Errorf("Expected InvalidArgument naming the non-numeric element, got %v", err)
+	}
+}
+
+func TestReload_PicksUpNewFiles(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "name: test"}, nil)
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "extra.csl"), []byte("name: extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"extra"}}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound before reload, got %v", err)
+	}
+
+	if err := svc.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"extra"}})
+	if err != nil {
+		t.Fatalf("Fetch after reload failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["name"]; got != "extra" {
+		t.Errorf("Expected name 'extra', got %v", got)
+	}
+	if stats := svc.config.cache.stats(false); stats.entries != 1 {
+		t.Errorf("Expected cache flushed on reload (1 entry after refetch), got %d", stats.entries)
+	}
+}
+
+func TestReload_BeforeInit(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+	if err := svc.Reload(context.Background()); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestReload_PollInterval(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "name: test"}, map[string]any{"reload_interval": "10ms"})
+	defer svc.Shutdown(context.Background(), &providerv1.ShutdownRequest{})
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "extra.csl"), []byte("name: extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"extra"}})
+		if err == nil {
+			if got := resp.Value.AsMap()["name"]; got != "extra" {
+				t.Errorf("Expected name 'extra', got %v", got)
+			}
+			break
+		}
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the new file to become visible after the reload interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReload_PollDoesNotBlockFetch(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "name: test"}, map[string]any{"reload_interval": "1h"})
+	defer svc.Shutdown(context.Background(), &providerv1.ShutdownRequest{})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	svc.readDir = func(name string) ([]os.DirEntry, error) {
+		close(started)
+		<-release
+		return os.ReadDir(name)
+	}
+
+	polled := make(chan struct{})
+	go func() {
+		svc.poll(svc.config)
+		close(polled)
+	}()
+	<-started
+
+	// The poll is enumerating; a fetch must not wait for it
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+		fetched <- err
+	}()
+	select {
+	case err := <-fetched:
+		if err != nil {
+			t.Errorf("Fetch failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Fetch blocked on a reload poll")
+	}
+
+	close(release)
+	<-polled
+}
+
+func TestReload_PollStopsOnShutdown(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "name: test"}, map[string]any{"reload_interval": "10ms"})
+
+	if svc.pollStop == nil {
+		t.Fatal("Expected a poller to be running")
+	}
+	if _, err := svc.Shutdown(context.Background(), &providerv1.ShutdownRequest{}); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if svc.pollStop != nil {
+		t.Error("Expected the poller to be stopped on Shutdown")
+	}
+}
+
+func TestInit_ReloadIntervalWithLazyScan(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"directory":       t.TempDir(),
+		"lazy_scan":       true,
+		"reload_interval": "1s",
+	})
+
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestFetch_SnapshotPreviousVersion(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: one\n"}, map[string]any{"snapshot_depth": 3})
+
+	fetchName := func(version string) (any, error) {
+		t.Helper()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(versionHeader, version))
+		resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Value.AsMap()["name"], nil
+	}
+
+	if name, err := fetchName("0"); err != nil || name != "one" {
+		t.Fatalf("Expected current name 'one', got %v (%v)", name, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("app:\n  name: second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if name, err := fetchName("0"); err != nil || name != "second" {
+		t.Errorf("Expected current name 'second', got %v (%v)", name, err)
+	}
+	if name, err := fetchName("-1"); err != nil || name != "one" {
+		t.Errorf("Expected previous name 'one', got %v (%v)", name, err)
+	}
+	if _, err := fetchName("-2"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound beyond the retained versions, got %v", err)
+	}
+	if _, err := fetchName("1"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a positive version, got %v", err)
+	}
+}
+
+func TestFetch_SnapshotDisabled(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: one\n"}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(versionHeader, "-1"))
+	_, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition without snapshot_depth, got %v", err)
+	}
+}
+
+func TestFetch_ETag(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "name: one"}, map[string]any{"etag": true})
+
+	fetchETag := func() string {
+		t.Helper()
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		etag, _ := resp.Value.AsMap()[etagKey].(string)
+		return etag
+	}
+
+	first := fetchETag()
+	if len(first) != etagLength+2 || first[0] != '"' || first[len(first)-1] != '"' {
+		t.Fatalf("Expected quoted %d-digit etag, got %q", etagLength, first)
+	}
+	if _, err := hex.DecodeString(strings.Trim(first, `"`)); err != nil {
+		t.Errorf("Expected hex etag, got %q", first)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("name: two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if second := fetchETag(); second == first {
+		t.Errorf("Expected etag to change with content, got %q twice", first)
+	}
+}
+
+func TestFetch_ETagRoundTrip(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: one\n"}, map[string]any{"etag": true})
+
+	fetch := func(pairs ...string) map[string]any {
+		t.Helper()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+		resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: []string{"config", "app"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		return resp.Value.AsMap()
+	}
+
+	etag, _ := fetch()[etagKey].(string)
+	for _, sent := range []string{etag, "W/" + etag, strings.Trim(etag, `"`)} {
+		if got := fetch(ifNoneMatchHeader, sent); got[notModifiedKey] != true {
+			t.Errorf("Expected not-modified for if-none-match %q, got %v", sent, got)
+		}
+	}
+
+	// A reshaped body carries its own tag, which the plain tag does not match
+	sampled, _ := fetch(sampleHeader, "true")[etagKey].(string)
+	if sampled == etag {
+		t.Errorf("Expected the sample etag to differ from %q", etag)
+	}
+	if got := fetch(sampleHeader, "true", ifNoneMatchHeader, etag); got[notModifiedKey] == true {
+		t.Errorf("Expected a full response for a sample with the plain etag, got %v", got)
+	}
+	if got := fetch(sampleHeader, "true", ifNoneMatchHeader, sampled); got[notModifiedKey] != true {
+		t.Errorf("Expected not-modified for a sample with its own etag, got %v", got)
+	}
+
+	// So does another path of the same file
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if whole, _ := resp.Value.AsMap()[etagKey].(string); whole == etag {
+		t.Errorf("Expected the whole-file etag to differ from the sub-path's %q", etag)
+	}
+}
+
+func TestInit_ExtensionTrim(t *testing.T) {
+	files := map[string]string{
+		"my.csl.csl":  "name: my",
+		"data.v1.csl": "name: data",
+		".csl":        "name: hidden",
+	}
+
+	tests := []struct {
+		name  string
+		extra map[string]any
+		want  map[string]string // fetch path -> name
+	}{
+		{
+			name: "last (default)",
+			want: map[string]string{"my.csl": "my", "data.v1": "data"},
+		},
+		{
+			name:  "all",
+			extra: map[string]any{"extension_trim": "all"},
+			want:  map[string]string{"my": "my", "data.v1": "data"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newInitializedService(t, files, tt.extra)
+
+			if len(svc.config.cslFiles) != len(tt.want) {
+				t.Errorf("Expected files %v, got %v", tt.want, svc.config.cslFiles)
+			}
+			for baseName, want := range tt.want {
+				resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{baseName}})
+				if err != nil {
+					t.Fatalf("Fetch %q failed: %v", baseName, err)
+				}
+				if got := resp.Value.AsMap()["name"]; got != want {
+					t.Errorf("Fetch %q: expected name %q, got %v", baseName, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInit_OnDuplicate(t *testing.T) {
+	files := map[string]string{
+		"my.csl":     "name: short",
+		"my.csl.csl": "name: long",
+	}
+
+	t.Run("error by default", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		for name, content := range map[string]string{
+			"my.csl":           files["my.csl"],
+			"my.csl.csl":       files["my.csl.csl"],
+			"your.csl":         "name: a",
+			"your.csl.csl":     "name: b",
+			"your.csl.csl.csl": "name: c",
+		} {
+			if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The message is the same on every run: names and candidates are sorted
+		want := `duplicate file base name "my": ["my.csl" "my.csl.csl"]`
+		for i := 0; i < 5; i++ {
+			svc := NewFileProviderService("0.1.0", "file")
+			config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "extension_trim": "all"})
+			_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("Expected error containing %s, got %v", want, err)
+			}
+		}
+	})
+
+	t.Run("first_wins is lexicographic", func(t *testing.T) {
+		svc, _ := newInitializedService(t, files, map[string]any{"extension_trim": "all", "on_duplicate": "first_wins"})
+
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"my"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if got := resp.Value.AsMap()["name"]; got != "short" {
+			t.Errorf("Expected my.csl to win, got %v", got)
+		}
+	})
+
+	t.Run("first_wins prefers the shallowest path", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		paths := []string{
+			filepath.Join(tmpDir, "a", "b", "x.csl"),
+			filepath.Join(tmpDir, "z", "x.csl"),
+			filepath.Join(tmpDir, "c", "x.csl"),
+		}
+		for _, path := range paths {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("name: "+filepath.Base(filepath.Dir(path))), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Listing order must not matter
+		for _, order := range [][]string{paths, {paths[2], paths[1], paths[0]}} {
+			svc := NewFileProviderService("0.1.0", "file")
+			config, _ := structpb.NewStruct(map[string]any{
+				"directory":    tmpDir,
+				"file_list":    stringsToAny(order),
+				"on_duplicate": "first_wins",
+			})
+			if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+			if got := svc.config.cslFiles["x"]; got != paths[2] {
+				t.Errorf("Expected %s (shallowest, then lexicographic) to win, got %s", paths[2], got)
+			}
+		}
+	})
+}
+
+func TestFetch_DefaultFile(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "database:\n  host: localhost\n",
+		"other.csl":  "database:\n  host: other-host\n",
+	}, map[string]any{"default_file": "config"})
+
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"database", "host"}, "localhost"},
+		{[]string{"config", "database", "host"}, "localhost"},
+		{[]string{"other", "database", "host"}, "other-host"},
+	}
+
+	for _, tt := range tests {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path})
+		if err != nil {
+			t.Fatalf("Fetch %v failed: %v", tt.path, err)
+		}
+		if got := resp.Value.AsMap()["value"]; got != tt.want {
+			t.Errorf("Fetch %v: expected %q, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"missing"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a key missing from the default file, got %v", err)
+	}
+}
+
+func TestInit_DefaultFileMissing(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte("name: test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "default_file": "nope"})
+	svc := NewFileProviderService("0.1.0", "file")
+	_, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestFetch_FetchRoot(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "public:\n  host: example.com\nsecret:\n  password: hunter2\n",
+	}, map[string]any{"fetch_root": []any{"public"}})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "host"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "example.com" {
+		t.Errorf("Expected host beneath fetch_root, got %v", got)
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap(); len(got) != 1 || got["host"] != "example.com" {
+		t.Errorf("Expected whole-file fetch to return only the fetch_root subtree, got %v", got)
+	}
+
+	for _, path := range [][]string{{"config", "secret"}, {"config", "public", "host"}} {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: path}); status.Code(err) != codes.NotFound {
+			t.Errorf("Fetch %v: expected NotFound outside fetch_root, got %v", path, err)
+		}
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"*"}})
+	if err != nil {
+		t.Fatalf("Fetch * failed: %v", err)
+	}
+	if _, ok := resp.Value.AsMap()["secret"]; ok {
+		t.Errorf("Expected merged fetch to hide data outside fetch_root, got %v", resp.Value.AsMap())
+	}
+}
+
+func TestFetch_FetchRootSkipsBlobs(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "public:\n  host: example.com\n",
+		"cert.pem":   "certificate",
+	}, map[string]any{"fetch_root": []any{"public"}, "blob_extensions": []any{".pem"}})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"cert.pem"}})
+	if err != nil {
+		t.Fatalf("Fetch of a blob failed under fetch_root: %v", err)
+	}
+	if resp.Value.AsMap()[blobKey] != true {
+		t.Errorf("Expected the blob payload, got %v", resp.Value.AsMap())
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"cert.pem", "base64"}})
+	if err != nil {
+		t.Fatalf("Fetch of a blob sub-path failed under fetch_root: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != base64.StdEncoding.EncodeToString([]byte("certificate")) {
+		t.Errorf("Expected the blob's base64, got %v", got)
+	}
+}
+
+func TestFetch_CachesParseErrors(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"bad.csl": "app:\n  name: x\n---\n"}, nil)
+
+	reads := 0
+	svc.readFile = func(name string) ([]byte, error) {
+		reads++
+		return os.ReadFile(name)
+	}
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"bad", "app", "name"}})
+		if err == nil {
+			t.Fatal("Expected malformed file to fail")
+		}
+		errs = append(errs, err)
+	}
+
+	if reads != 1 {
+		t.Errorf("Expected the malformed file to be read once, got %d reads", reads)
+	}
+	if errs[0].Error() != errs[1].Error() || status.Code(errs[1]) != status.Code(errs[0]) {
+		t.Errorf("Expected the same error on both fetches, got %v and %v", errs[0], errs[1])
+	}
+
+	// A changed file is re-read
+	if err := os.WriteFile(filepath.Join(tmpDir, "bad.csl"), []byte("app:\n  name: fixed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"bad", "app", "name"}})
+	if err != nil {
+		t.Fatalf("Fetch after fix failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "fixed" || reads != 2 {
+		t.Errorf("Expected fixed value after one more read, got %v after %d reads", got, reads)
+	}
+}
+
+func TestFetch_CacheTTLExpiresUnchangedFile(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"},
+		map[string]any{"cache_ttl": "50ms"})
+
+	reads := 0
+	svc.readFile = func(name string) ([]byte, error) {
+		reads++
+		return os.ReadFile(name)
+	}
+
+	fetch := func() {
+		t.Helper()
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name"}}); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+
+	fetch()
+	fetch()
+	if reads != 1 {
+		t.Fatalf("Expected one read within the TTL, got %d", reads)
+	}
+
+	// Neither modtime nor size changes, but the entry expires
+	time.Sleep(60 * time.Millisecond)
+	fetch()
+	if reads != 2 {
+		t.Errorf("Expected a re-parse after the TTL, got %d reads", reads)
+	}
+}
+
+func TestFetch_BlobExtensions(t *testing.T) {
+	pem := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl": "name: test",
+		"cert.pem":   pem,
+		"notes.txt":  "ignored",
+	}, map[string]any{"blob_extensions": []any{"pem"}})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"cert.pem"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	data := resp.Value.AsMap()
+	if data[blobKey] != true {
+		t.Errorf("Expected %s marker, got %v", blobKey, data)
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte(pem)); data["base64"] != want {
+		t.Errorf("Expected base64 %q, got %v", want, data["base64"])
+	}
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"notes.txt"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected files without a blob extension to be ignored, got %v", err)
+	}
+}
+
+func TestFetch_SameBaseNameAcrossFormatsDoesNotCollide(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{
+		"config.csl":  "app:\n  name: csl\n",
+		"config.json": `{"app": {"name": "json"}}`,
+	}, map[string]any{"blob_extensions": []any{".json"}})
+
+	resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app", "name"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if got := resp.Value.AsMap()["value"]; got != "csl" {
+		t.Errorf("Expected config to be the .csl file, got %v", got)
+	}
+
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config.json"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resp.Value.AsMap()[blobKey] != true {
+		t.Errorf("Expected config.json to be served as a blob, got %v", resp.Value.AsMap())
+	}
+
+	// config.json.csl is served as config.json too: the clash is a
+	// duplicate like any other, decided by on_duplicate
+	files := map[string]string{
+		"config.json.csl": "app:\n  name: csl\n",
+		"config.json":     `{"app": {"name": "json"}}`,
+		"other.csl":       "app:\n  name: other\n",
+	}
+	tmpDir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir, "blob_extensions": []any{".json"}})
+	_, err = NewFileProviderService("0.1.0", "file").Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config})
+	if err == nil || !strings.Contains(err.Error(), `duplicate file base name "config.json": ["config.json" "config.json.csl"]`) {
+		t.Errorf("Expected a duplicate base name error, got %v", err)
+	}
+
+	svc, _ = newInitializedService(t, files, map[string]any{"blob_extensions": []any{".json"}, "on_duplicate": "first_wins"})
+	resp, err = svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config.json"}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resp.Value.AsMap()[blobKey] != true {
+		t.Errorf("Expected first_wins to serve the lexicographically first config.json blob, got %v", resp.Value.AsMap())
+	}
+}
+
+func TestFetch_BlobTooLarge(t *testing.T) {
+	for _, cacheEntries := range []int{128, 0} {
+		t.Run(fmt.Sprintf("cache_max_entries=%d", cacheEntries), func(t *testing.T) {
+			svc, _ := newInitializedService(t, map[string]string{
+				"config.csl": "name: test",
+				"big.pem":    strings.Repeat("x", 64),
+			}, map[string]any{"blob_extensions": []any{".pem"}, "max_blob_bytes": 16, "cache_max_entries": cacheEntries})
+
+			// The limit applies before the blob is read into memory
+			svc.readFile = func(name string) ([]byte, error) {
+				t.Errorf("Expected the oversized blob not to be read, read %s", name)
+				return os.ReadFile(name)
+			}
+
+			_, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"big.pem"}})
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("Expected ResourceExhausted for an oversized blob, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetch_SourceInfoRoots(t *testing.T) {
+	svc := NewFileProviderService("0.1.0", "file")
+
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirA, "database.csl"), []byte("db:\n  host: a.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirB, "network.csl"), []byte("net:\n  cidr: 10.0.0.0/8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, _ := structpb.NewStruct(map[string]any{
+		"roots":       map[string]any{"tenantA": dirA, "tenantB": dirB},
+		"source_info": true,
+	})
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	tests := []struct {
+		path       []string
+		root, file string
+	}{
+		{[]string{"tenantA", "database", "db"}, "tenantA", "database"},
+		{[]string{"tenantB", "network"}, "tenantB", "network"},
+	}
+
+	for _, tt := range tests {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: tt.path})
+		if err != nil {
+			t.Fatalf("Fetch %v failed: %v", tt.path, err)
+		}
+
+		source, ok := resp.Value.AsMap()[sourceKey].(map[string]any)
+		if !ok {
+			t.Fatalf("Fetch %v: expected %s, got %v", tt.path, sourceKey, resp.Value.AsMap())
+		}
+		if source["root"] != tt.root || source["file"] != tt.file || source["directory"] != svc.config.roots[tt.root] {
+			t.Errorf("Fetch %v: expected root %q file %q in %s, got %v", tt.path, tt.root, tt.file, svc.config.roots[tt.root], source)
+		}
+	}
+}
+
+func TestFetch_SourceInfoParseTime(t *testing.T) {
+	svc, _ := newInitializedService(t, map[string]string{"config.csl": "app:\n  name: test\n"}, map[string]any{"source_info": true})
+
+	fetchSource := func() map[string]any {
+		t.Helper()
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"config", "app"}})
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		source, ok := resp.Value.AsMap()[sourceKey].(map[string]any)
+		if !ok {
+			t.Fatalf("Expected %s, got %v", sourceKey, resp.Value.AsMap())
+		}
+		return source
+	}
+
+	fresh := fetchSource()
+	parseMs, ok := fresh["parse_ms"].(float64)
+	if !ok || parseMs < 0 || parseMs > 10000 {
+		t.Errorf("Expected a plausible parse_ms after a fresh parse, got %v", fresh["parse_ms"])
+	}
+	if fresh["cache_hit"] != false {
+		t.Errorf("Expected cache_hit false after a fresh parse, got %v", fresh["cache_hit"])
+	}
+
+	cached := fetchSource()
+	if cached["cache_hit"] != true {
+		t.Errorf("Expected cache_hit true on the second fetch, got %v", cached["cache_hit"])
+	}
+	if cached["parse_ms"] != parseMs {
+		t.Errorf("Expected the original parse_ms %v on a cache hit, got %v", parseMs, cached["parse_ms"])
+	}
+}
+
+func TestFetch_LazyScan(t *testing.T) {
+	svc, tmpDir := newInitializedService(t, map[string]string{"config.csl": "name: test"}, map[string]any{"lazy_scan": true})
+
+	if len(svc.config.cslFiles) != 0 {
+		t.Errorf("Expected no files enumerated at Init, got %v", svc.config.cslFiles)
+	}
+
+	// Files created after Init resolve on demand
+	if err := os.WriteFile(filepath.Join(tmpDir, "later.csl"), []byte("name: later"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"config": "test", "later": "later"} {
+		resp, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{name}})
+		if err != nil {
+			t.Fatalf("Fetch %q failed: %v", name, err)
+		}
+		if got := resp.Value.AsMap()["name"]; got != want {
+			t.Errorf("Fetch %q: expected %q, got %v", name, want, got)
+		}
+	}
+
+	for _, path := range [][]string{{"missing"}, {"../config"}, {"sub/config"}} {
+		if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: path}); status.Code(err) != codes.NotFound {
+			t.Errorf("Fetch %v: expected NotFound, got %v", path, err)
+		}
+	}
+
+	if _, err := svc.Fetch(context.Background(), &providerv1.FetchRequest{Path: []string{"*"}}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for [\"*\"] in lazy mode, got %v", err)
+	}
+}
+
+// benchmarkInit measures Init against a directory of n files.
+func benchmarkInit(b *testing.B, n int, extra map[string]any) {
+	tmpDir := b.TempDir()
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%05d.csl", i)), []byte("name: test"), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	configMap := map[string]any{"directory": tmpDir}
+	for key, value := range extra {
+		configMap[key] = value
+	}
+	config, err := structpb.NewStruct(configMap)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	svc := NewFileProviderService("0.1.0", "file")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInit_EagerScan(b *testing.B) {
+	benchmarkInit(b, 5000, nil)
+}
+
+func BenchmarkInit_LazyScan(b *testing.B) {
+	benchmarkInit(b, 5000, map[string]any{"lazy_scan": true})
+}
+
+func TestToProtoStruct_NamesUnsupportedKey(t *testing.T) {
+	data := map[string]any{
+		"app": map[string]any{
+			"name":  "web",
+			"ports": []any{80, struct{}{}},
+		},
+	}
+
+	_, err := toProtoStruct(data)
+	if err == nil {
+		t.Fatal("Expected conversion to fail")
+	}
+	if !strings.Contains(err.Error(), `value at "app.ports.1" has unsupported type struct {}`) {
+		t.Errorf("Expected error naming app.ports.1 and its type, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package provider
+
+// Skeletons.
+//
+// The compiler plans reference resolution from a file's structure, not its
+// data, so it can send the "skeleton: true" gRPC metadata header to receive a
+// fetched value with every map key and list element kept, each scalar
+// replaced by its type name ("string", "number" or "bool"), and every
+// reference, in either ref_format, rendered as {"__ref__": {"alias", "path"}}.
+// A request cannot ask for both a sample and a skeleton.
+const skeletonHeader = "skeleton"
+
+// skeletonValue returns a copy of v with scalars replaced by their type names
+// and references structured. v itself is never modified, as it may be held
+// by the parse cache.
+func skeletonValue(v any) any {
+	if ref, ok := referenceOf(v); ok {
+		if m, ok := v.(map[string]any); ok {
+			// Already structured; keep target_file if present
+			return m
+		}
+		return ref.structured()
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			out[k] = skeletonValue(child)
+		}
+		// Keep the type URL of a typed_values Any
+		if typeURL, ok := val["@type"]; ok {
+			out["@type"] = typeURL
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			out[i] = skeletonValue(child)
+		}
+		return out
+
+	case string:
+		return scalarType(val)
+
+	case bool:
+		return scalarBool
+
+	case float64, int, int64:
+		return scalarNumber
+
+	default:
+		return "null"
+	}
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Snapshots.
+//
+// With "snapshot_depth" set to N, the provider keeps the last N distinct
+// parsed versions of each file in memory, across Reload but not across Init.
+// A fetch selects a version with the "version" gRPC metadata header: "0" (or
+// no header) is the current file, "-1" the version parsed before it, and so
+// on. Only versions the provider actually parsed are retained, so a change
+// that was never fetched leaves no snapshot. Historical fetches return the
+// data as parsed, without "__hash__" or "__etag__" (which describe the
+// current file) and without inlined imports.
+const versionHeader = "version"
+
+// snapshotStore retains recent parsed versions per file.
+type snapshotStore struct {
+	mu       sync.Mutex
+	depth    int
+	versions map[string][]snapshot // oldest first
+}
+
+// snapshot is one retained version of a file.
+type snapshot struct {
+	sum  [sha256.Size]byte
+	data any
+}
+
+// newSnapshotStore creates a store keeping depth versions per file.
+func newSnapshotStore(depth int) *snapshotStore {
+	return &snapshotStore{depth: depth, versions: make(map[string][]snapshot)}
+}
+
+// record retains data as the latest version of filePath unless content is
+// unchanged from the latest retained version.
+func (st *snapshotStore) record(filePath string, content []byte, data any) {
+	sum := sha256.Sum256(content)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	versions := st.versions[filePath]
+	if n := len(versions); n > 0 && versions[n-1].sum == sum {
+		return
+	}
+
+	versions = append(versions, snapshot{sum: sum, data: data})
+	if len(versions) > st.depth {
+		versions = versions[len(versions)-st.depth:]
+	}
+	st.versions[filePath] = versions
+}
+
+// get returns the version of filePath at offset (0 latest, -1 the one
+// before, ...) and the number of versions retained.
+func (st *snapshotStore) get(filePath string, offset int) (any, int, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	versions := st.versions[filePath]
+	i := len(versions) - 1 + offset
+	if i < 0 || i >= len(versions) {
+		return nil, len(versions), false
+	}
+	return versions[i].data, len(versions), true
+}
+
+// requestedVersion returns the version offset from the request's version
+// header, or 0 when absent. Positive or non-integer values fail with
+// InvalidArgument.
+func requestedVersion(ctx context.Context) (int, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, nil
+	}
+
+	values := md.Get(versionHeader)
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(values[0])
+	if err != nil || version > 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be 0 or a negative integer (e.g. -1 for the previous version), got %q", versionHeader, values[0])
+	}
+	return version, nil
+}
+
+// snapshotData returns a historical version of filePath. The file is parsed
+// first, so that its current content counts as version 0.
+func (s *FileProviderService) snapshotData(filePath string, version int) (any, error) {
+	if s.config.snapshots == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s requires snapshot_depth to be configured", versionHeader)
+	}
+
+	// A current file that fails to parse is not recorded, but its earlier
+	// versions remain available
+	_, _ = s.parseFile(filePath)
+
+	data, retained, ok := s.config.snapshots.get(filePath, version)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "version %d of %s is not retained (%d version(s) available)", version, filePath, retained)
+	}
+	data, err := s.config.selectVariant(filePath, data)
+	if err != nil {
+		return nil, parseStatus(fmt.Sprintf("failed to read version %d of %s", version, filePath), err)
+	}
+	return data, nil
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// sourceKey holds provenance of a file fetch when source_info is enabled:
+//
+//	"__source__": {"root": ..., "directory": ..., "file": ...}
+//
+// "root" is the configured root name that owns the file (empty without
+// roots), "directory" the absolute directory it was enumerated from, and
+// "file" its key within that directory (e.g. "env/dev" when recursive).
+// With base_dir and overlay_dir, "layer" is "overlay" for a file served from
+// the overlay and "base" for one the overlay does not shadow.
+//
+// "parse_ms" is how long the file took to parse, in milliseconds, and
+// "cache_hit" whether this fetch was served from the parse cache, in which
+// case parse_ms is the time of the parse that filled it. Both are omitted for
+// historical (version) fetches, which are not parsed.
+const sourceKey = "__source__"
+
+// setSource adds the "__source__" entry for target to value. timing is nil
+// when the data was not parsed by this fetch.
+func (s *FileProviderService) setSource(value *structpb.Struct, target fetchTarget, timing *parseTiming) {
+	root := strings.TrimSuffix(target.prefix, "/")
+	source := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"root":      structpb.NewStringValue(root),
+		"directory": structpb.NewStringValue(s.config.fileRoot(target.key)),
+		"file":      structpb.NewStringValue(strings.TrimPrefix(target.key, target.prefix)),
+	}}
+	if s.config.scan.overlayDir != "" {
+		layer := "base"
+		if s.config.fromOverlay(target.key) {
+			layer = "overlay"
+		}
+		source.Fields["layer"] = structpb.NewStringValue(layer)
+	}
+	if timing != nil {
+		source.Fields["parse_ms"] = structpb.NewNumberValue(float64(timing.duration) / float64(time.Millisecond))
+		source.Fields["cache_hit"] = structpb.NewBoolValue(timing.cacheHit)
+	}
+	value.Fields[sourceKey] = structpb.NewStructValue(source)
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkSourceAliases implements check_source_alias: every .csl file is parsed
+// and each source declaration of this provider's type whose alias differs
+// from the provider alias produces a warning, since references written
+// against the declared alias will not resolve here. Declarations of other
+// provider types are not checked.
+//
+// Warnings are logged and kept for the __warnings__ control path. Files that
+// cannot be read or parsed are skipped; Fetch reports those errors.
+func (s *FileProviderService) checkSourceAliases(config *providerConfig) []any {
+	keys := make([]string, 0, len(config.cslFiles))
+	for key, filePath := range config.cslFiles {
+		if strings.HasSuffix(filePath, cslExtension) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	warnings := []any{}
+	for _, key := range keys {
+		filePath := config.cslFiles[key]
+		content, err := s.readFile(filePath)
+		if err != nil {
+			continue
+		}
+		tree, err := s.parser.Parse(bytes.NewReader(content), filePath)
+		if err != nil {
+			continue
+		}
+
+		for _, stmt := range tree.Statements {
+			decl, ok := stmt.(*ast.SourceDecl)
+			if !ok || decl.Type != s.providerType || decl.Alias == config.alias {
+				continue
+			}
+
+			message := fmt.Sprintf("file %q declares source alias %q but the provider alias is %q", key, decl.Alias, config.alias)
+			log.Printf("warning: %s", message)
+			warnings = append(warnings, map[string]any{
+				"kind":     "source_alias_mismatch",
+				"file":     key,
+				"line":     decl.SourceSpan.StartLine,
+				"declared": decl.Alias,
+				"alias":    config.alias,
+				"message":  message,
+			})
+		}
+	}
+	return warnings
+}
+
+// fetchWarnings returns the warnings collected during Init.
+//
+// Path: ["__warnings__"]. The result is {"warnings": [...]}, empty unless a
+// validation such as check_source_alias found something.
+func (s *FileProviderService) fetchWarnings(ctx context.Context, args []string) (any, error) {
+	if len(args) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s does not accept arguments", controlWarnings)
+	}
+
+	warnings := s.config.warnings
+	if warnings == nil {
+		warnings = []any{}
+	}
+	return map[string]any{"warnings": warnings}, nil
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Transforms accepted as values of the "transforms" config key.
+const (
+	transformBase64Decode = "base64decode"
+	transformTrim         = "trim"
+	transformLower        = "lower"
+)
+
+// transformFuncs maps each transform name to its implementation.
+var transformFuncs = map[string]func(string) (string, error){
+	transformBase64Decode: base64Decode,
+	transformTrim: func(s string) (string, error) {
+		return strings.TrimSpace(s), nil
+	},
+	transformLower: func(s string) (string, error) {
+		return strings.ToLower(s), nil
+	},
+}
+
+// transformNames returns the known transform names, sorted.
+func transformNames() []string {
+	names := make([]string, 0, len(transformFuncs))
+	for name := range transformFuncs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// fieldTransform applies the named transform to the string value at path,
+// relative to the root of every file.
+type fieldTransform struct {
+	path []string
+	name string
+}
+
+// base64Decode decodes standard base64. The decoded bytes must be valid
+// UTF-8, as Struct strings cannot carry arbitrary binary.
+func base64Decode(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return "", fmt.Errorf("invalid base64: %w", err)
+	}
+	if !utf8.Valid(decoded) {
+		return "", fmt.Errorf("decoded value is not valid UTF-8")
+	}
+	return string(decoded), nil
+}
+
+// applyTransforms rewrites the values of a freshly converted file in place.
+// Paths that do not exist in the file are skipped; a transform whose target
+// is not a string, or that fails, fails the conversion.
+func (c *converter) applyTransforms(data map[string]any) error {
+	for _, t := range c.transforms {
+		parent, ok := lookupPath(data, t.path[:len(t.path)-1])
+		if !ok {
+			continue
+		}
+		m, ok := parent.(map[string]any)
+		if !ok {
+			continue
+		}
+		key := t.path[len(t.path)-1]
+		value, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		dotted := strings.Join(t.path, ".")
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("transform %q at %q: value is %T, not a string", t.name, dotted, value)
+		}
+		transformed, err := transformFuncs[t.name](str)
+		if err != nil {
+			return fmt.Errorf("transform %q at %q: %w", t.name, dotted, err)
+		}
+		m[key] = transformed
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"encoding/json"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// typedValue recognizes Go duration strings (e.g. "1h30m") and RFC 3339
+// timestamps and returns them as google.protobuf.Any in its canonical JSON
+// form, e.g. {"@type": "type.googleapis.com/google.protobuf.Duration",
+// "value": "5400s"}.
+//
+// FetchResponse.value is a Struct and cannot carry an Any message directly,
+// but Struct can carry the Any JSON mapping: typed consumers decode it with
+// protojson.Unmarshal into an anypb.Any, while generic consumers still see
+// plain JSON. It reports false for any other value.
+func typedValue(value string) (map[string]any, bool) {
+	var msg proto.Message
+	if d, err := time.ParseDuration(value); err == nil && value != "0" {
+		msg = durationpb.New(d)
+	} else if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		msg = timestamppb.New(t)
+	} else {
+		return nil, false
+	}
+
+	wrapped, err := anypb.New(msg)
+	if err != nil {
+		return nil, false
+	}
+
+	encoded, err := protojson.Marshal(wrapped)
+	if err != nil {
+		return nil, false
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return nil, false
+	}
+	return result, true
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unitPattern matches a number immediately followed by a unit suffix, with
+// nothing else in the value. Matching is deliberately strict (no spaces, no
+// signs, no unknown suffixes) so arbitrary strings are left untouched.
+var unitPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z]+)$`)
+
+// unitScales maps recognized suffixes (lower-cased) to their normalized unit
+// and multiplier. Sizes use binary multiples, so "512mb" is 512 * 1024^2 bytes.
+// Minutes are spelled "min": a bare "m" would also match millicores ("500m")
+// and meters.
+var unitScales = map[string]struct {
+	unit  string
+	scale float64
+}{
+	"b":   {"bytes", 1},
+	"kb":  {"bytes", 1 << 10},
+	"kib": {"bytes", 1 << 10},
+	"mb":  {"bytes", 1 << 20},
+	"mib": {"bytes", 1 << 20},
+	"gb":  {"bytes", 1 << 30},
+	"gib": {"bytes", 1 << 30},
+	"tb":  {"bytes", 1 << 40},
+	"tib": {"bytes", 1 << 40},
+	"ms":  {"seconds", 0.001},
+	"s":   {"seconds", 1},
+	"min": {"seconds", 60},
+	"h":   {"seconds", 3600},
+}
+
+// normalizeUnit converts values such as "512mb" or "30s" into
+// {"value": <number>, "unit": "bytes"|"seconds"}. It reports false for any
+// value that is not a plain number with a recognized suffix.
+func normalizeUnit(value string) (map[string]any, bool) {
+	m := unitPattern.FindStringSubmatch(value)
+	if m == nil {
+		return nil, false
+	}
+
+	scale, ok := unitScales[strings.ToLower(m[2])]
+	if !ok {
+		return nil, false
+	}
+
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return map[string]any{
+		"value": n * scale.scale,
+		"unit":  scale.unit,
+	}, true
+}
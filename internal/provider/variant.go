@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Variants.
+//
+// A file may hold several named configurations as top-level sections, e.g.
+// "dev:" and "prod:". With active_variant set, every file is read as if it
+// contained only that section, so ["config", "host"] resolves to the "host"
+// key of the active variant without naming it. fetch_root then applies
+// within the variant. A file without the section is read whole, unless
+// strict_variant is set, in which case reading it fails with NotFound.
+
+// errVariantNotFound is returned for a file lacking the active variant under
+// strict_variant.
+var errVariantNotFound = errors.New("active variant not found")
+
+// selectVariant returns the active variant's section of the converted data
+// of filePath, or data itself when no variant is configured. Blobs have no
+// sections and are returned as-is.
+func (c *providerConfig) selectVariant(filePath string, data any) (any, error) {
+	if !isCSLFile(filePath) {
+		return data, nil
+	}
+	keys, err := c.variantKeys(data)
+	if err != nil || len(keys) == 0 {
+		return data, err
+	}
+	return data.(map[string]any)[keys[0]], nil
+}
+
+// variantKeys returns the keys leading from a .csl file's data to its active
+// variant: the variant's name when the file has that section, otherwise none.
+// A file lacking it under strict_variant fails with errVariantNotFound.
+func (c *providerConfig) variantKeys(data any) ([]string, error) {
+	if c.activeVariant == "" {
+		return nil, nil
+	}
+
+	if m, ok := data.(map[string]any); ok {
+		if _, ok := m[c.activeVariant].(map[string]any); ok {
+			return []string{c.activeVariant}, nil
+		}
+	}
+
+	if c.strictVariant {
+		return nil, fmt.Errorf("%w: file has no section %q", errVariantNotFound, c.activeVariant)
+	}
+	return nil, nil
+}
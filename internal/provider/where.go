@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Operators of the __where__ predicate language.
+const (
+	whereEquals    = "=="
+	whereNotEquals = "!="
+	whereExists    = "exists"
+)
+
+// fetchWhere lists the files whose parsed content matches a predicate.
+//
+// Path: ["__where__", <dotted key path>, <operator>, <value>], e.g.
+// ["__where__", "app.enabled", "==", "true"]. The predicate language is
+// deliberately minimal:
+//
+//   - "==" matches when the value at the key path is a scalar equal to value
+//   - "!=" matches when the key exists and is not a scalar equal to value
+//   - "exists" (no value) matches when the key path exists
+//
+// Values are compared as text, since all scalars are strings. Key paths are
+// split on "." and looked up beneath fetch_root; a file missing the path
+// never matches "==" or "!=". Every .csl file is read through the parse cache;
+// blobs are skipped. The result is {"files": [...]}, sorted.
+func (s *FileProviderService) fetchWhere(ctx context.Context, args []string) (any, error) {
+	if len(args) < 2 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a key path, an operator and a value", controlWhere)
+	}
+
+	keyPath, op, operands := args[0], args[1], args[2:]
+	switch op {
+	case whereEquals, whereNotEquals:
+		if len(operands) != 1 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s operator %q expects exactly one value", controlWhere, op)
+		}
+	case whereExists:
+		if len(operands) != 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s operator %q takes no value", controlWhere, op)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "%s operator must be one of %q, got %q",
+			controlWhere, []string{whereEquals, whereNotEquals, whereExists}, op)
+	}
+	if keyPath == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "%s key path cannot be empty", controlWhere)
+	}
+	if s.config.scan.lazy {
+		return nil, errLazyScan(controlWhere)
+	}
+
+	keyPathKeys := strings.Split(keyPath, ".")
+
+	matches := []string{}
+	for key, filePath := range s.config.cslFiles {
+		if !isCSLFile(filePath) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		data, err := s.loadFile(filePath)
+		if err != nil {
+			return nil, parseStatus(fmt.Sprintf("failed to parse file %q", key), err)
+		}
+
+		value, exists := lookupPath(data, s.scopedKeys(filePath, keyPathKeys))
+		if whereMatches(op, operands, value, exists) {
+			matches = append(matches, key)
+		}
+	}
+	sort.Strings(matches)
+
+	return map[string]any{"files": stringsToAny(matches)}, nil
+}
+
+// whereMatches evaluates a __where__ predicate against the value found (or
+// not) at the key path.
+func whereMatches(op string, operands []string, value any, exists bool) bool {
+	if !exists {
+		return false
+	}
+
+	switch op {
+	case whereExists:
+		return true
+	case whereEquals:
+		return scalarEquals(value, operands[0])
+	default:
+		return !scalarEquals(value, operands[0])
+	}
+}
+
+// scalarEquals reports whether value is a scalar whose text is want.
+func scalarEquals(value any, want string) bool {
+	switch value.(type) {
+	case map[string]any, []any, nil:
+		return false
+	}
+	return fmt.Sprint(value) == want
+}
@@ -0,0 +1,261 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/autonomous-bits/nomos/libs/parser/pkg/ast"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchSet rewrites a single scalar leaf in a file. It is rejected unless the
+// provider was initialized with allow_write: true.
+//
+// Path: ["__set__", "file", "key", ..., "value"]. Only the value's source text
+// is replaced, so formatting, ordering and comments elsewhere in the file are
+// preserved. With active_variant, keys are resolved within the variant as
+// Fetch resolves them. Every write is logged for auditing.
+func (s *FileProviderService) fetchSet(ctx context.Context, args []string) (any, error) {
+	if !s.config.allowWrite {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is disabled; set allow_write: true to enable writes", controlSet)
+	}
+
+	if len(args) < 3 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s expects a file name, at least one key and a value", controlSet)
+	}
+
+	key, value := args[0], args[len(args)-1]
+
+	filePath, exists := s.config.lookupFile(key)
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "file %q not found", key)
+	}
+	keys := s.scopedKeys(filePath, args[1:len(args)-1])
+
+	// Fetch reads within the active variant, so writes target it too
+	if s.config.activeVariant != "" {
+		data, err := s.parseFile(filePath)
+		if err != nil {
+			return nil, parseStatus("failed to parse file", err)
+		}
+		variant, err := s.config.variantKeys(data)
+		if err != nil {
+			return nil, parseStatus("failed to parse file", err)
+		}
+		keys = append(variant, keys...)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.rewriteLeaf(filePath, keys, value); err != nil {
+		return nil, err
+	}
+	// The cache only compares modtime and size, which a same-length value
+	// written within one modtime tick leaves unchanged
+	if s.config.cache != nil {
+		s.config.cache.forget(filePath)
+	}
+
+	log.Printf("audit: %s alias=%q file=%q path=%q", controlSet, s.config.alias, key, strings.Join(keys, "."))
+
+	return map[string]any{
+		"file":  key,
+		"path":  stringsToAny(keys),
+		"value": value,
+	}, nil
+}
+
+// rewriteLeaf replaces the scalar value at keys in the file with value.
+func (s *FileProviderService) rewriteLeaf(filePath string, keys []string, value string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to read file: %v", err)
+	}
+
+	tree, err := s.parser.Parse(bytes.NewReader(content), filePath)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "cannot rewrite unparseable file: %v", err)
+	}
+
+	expr, err := findLeaf(tree, keys)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	span := expr.Span()
+	if span.StartLine < 1 || span.StartLine > len(lines) {
+		return status.Errorf(codes.Internal, "value for %q has an invalid source position", strings.Join(keys, "."))
+	}
+
+	line := lines[span.StartLine-1]
+	start := span.StartCol - 1
+	end := scalarEnd(line, start)
+	if start < 0 || end <= start {
+		return status.Errorf(codes.Internal, "value for %q has an invalid source position", strings.Join(keys, "."))
+	}
+
+	rendered, err := renderScalar(line[start:end], value)
+	if err != nil {
+		return err
+	}
+	lines[span.StartLine-1] = line[:start] + rendered + line[end:]
+
+	return writeFileAtomic(filePath, []byte(strings.Join(lines, "")))
+}
+
+// findLeaf locates the scalar expression at keys within tree.
+func findLeaf(tree *ast.AST, keys []string) (ast.Expr, error) {
+	notFound := status.Errorf(codes.NotFound, "key %q not found", strings.Join(keys, "."))
+
+	var entries []ast.MapEntry
+	var expr ast.Expr
+	for _, stmt := range tree.Statements {
+		section, ok := stmt.(*ast.SectionDecl)
+		if !ok || section.Name != keys[0] {
+			continue
+		}
+		expr, entries = section.Value, section.Entries
+	}
+	if expr == nil && entries == nil {
+		return nil, notFound
+	}
+
+	for _, key := range keys[1:] {
+		if expr != nil {
+			m, ok := expr.(*ast.MapExpr)
+			if !ok {
+				return nil, notFound
+			}
+			entries = m.Entries
+		}
+
+		expr = nil
+		for _, entry := range entries {
+			if !entry.Spread && entry.Key == key {
+				expr = entry.Value
+			}
+		}
+		if expr == nil {
+			return nil, notFound
+		}
+	}
+
+	switch expr.(type) {
+	case *ast.StringLiteral, *ast.IdentExpr:
+		return expr, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "value at %q is not a scalar leaf", strings.Join(keys, "."))
+	}
+}
+
+// scalarEnd returns the end offset of the scalar token starting at start.
+// Quoted tokens end after the closing quote; bare tokens end at whitespace or
+// a comment.
+func scalarEnd(line string, start int) int {
+	if start >= len(line) {
+		return -1
+	}
+
+	if q := line[start]; q == '"' || q == '\'' {
+		closing := strings.IndexByte(line[start+1:], q)
+		if closing < 0 {
+			return -1
+		}
+		return start + 1 + closing + 1
+	}
+
+	end := start
+	for end < len(line) && !strings.ContainsRune(" \t\r\n#", rune(line[end])) {
+		end++
+	}
+	return end
+}
+
+// renderScalar formats value for the file, keeping the original quoting style
+// where the value allows it. A value that would not read back as itself
+// unquoted (e.g. one containing ":", "#" or spaces) is quoted with whichever
+// quote character it does not contain. The parser has no escape sequences and
+// reads a leading "@" as a reference even when quoted, so values containing
+// newlines or both quote characters, or starting with "@", are rejected.
+func renderScalar(original, value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", status.Error(codes.InvalidArgument, "value cannot contain newlines")
+	}
+	if strings.HasPrefix(value, "@") {
+		return "", status.Error(codes.InvalidArgument, "value cannot start with @, which would be read as a reference")
+	}
+
+	if q := original[0]; q == '"' || q == '\'' {
+		if strings.IndexByte(value, q) < 0 {
+			return string(q) + value + string(q), nil
+		}
+	} else if plainScalar(value) {
+		return value, nil
+	}
+
+	for _, q := range []byte{'"', '\''} {
+		if strings.IndexByte(value, q) < 0 {
+			return string(q) + value + string(q), nil
+		}
+	}
+	return "", status.Error(codes.InvalidArgument, `value cannot contain both " and '`)
+}
+
+// plainScalar reports whether value can be written unquoted: it is non-empty
+// and made only of letters, digits and "._-/+".
+func plainScalar(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-/+", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFileAtomic replaces filePath with content via a temporary file in the
+// same directory, preserving the original permissions. A symlinked filePath
+// is resolved first and its target replaced, so the link itself is kept.
+func writeFileAtomic(filePath string, content []byte) error {
+	filePath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to resolve file: %v", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to stat file: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*")
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return status.Errorf(codes.Internal, "failed to write file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return status.Errorf(codes.Internal, "failed to write file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return status.Errorf(codes.Internal, "failed to set file mode: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return status.Errorf(codes.Internal, "failed to replace file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package fileprovider is the public entry point for embedding the file
+// provider in another Go program instead of running it as a separate
+// process.
+//
+// The service itself lives in an internal package; Service and New expose
+// it, and the helpers below build on its Init and Fetch methods.
+package fileprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/autonomous-bits/nomos-provider-file/internal/provider"
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Service is the file provider's gRPC service implementation.
+type Service = provider.FileProviderService
+
+// New creates a Service reporting version and providerType from Info. It
+// must be initialized with Init before Fetch.
+func New(version, providerType string) *Service {
+	return provider.NewFileProviderService(version, providerType)
+}
+
+// ValidateConfig checks an Init configuration without touching the
+// filesystem: unknown keys, value types, allowed values, and conflicting
+// options. It returns an InvalidArgument status describing the first problem
+// found, or nil if Init would accept the configuration (assuming its
+// directories exist and contain .csl files).
+func ValidateConfig(cfg map[string]any) error {
+	return provider.ValidateConfig(cfg)
+}
+
+// FetchInto fetches path in-process and unmarshals the value into a T, for
+// embedders that prefer their own types to map[string]any.
+//
+// The value is the FetchResponse value encoded as JSON, so a non-map result
+// is found under "value" and any reserved keys (e.g. "__hash__") are present
+// alongside the data; fields T does not declare are ignored. Scalars are
+// strings in converted data, so T's leaf fields should be strings too: a
+// mismatch such as a number field fails with a wrapped *json.UnmarshalTypeError.
+func FetchInto[T any](svc *Service, ctx context.Context, path []string) (T, error) {
+	var result T
+
+	resp, err := svc.Fetch(ctx, &providerv1.FetchRequest{Path: path})
+	if err != nil {
+		return result, err
+	}
+
+	encoded, err := protojson.Marshal(resp.Value)
+	if err != nil {
+		return result, fmt.Errorf("fetch %q: failed to encode value: %w", path, err)
+	}
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return result, fmt.Errorf("fetch %q: failed to unmarshal into %T: %w", path, result, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+package fileprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	providerv1 "github.com/autonomous-bits/nomos/libs/provider-proto/gen/go/nomos/provider/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFetchInto(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "database:\n  host: db.local\n  port: 5432\n  replicas:\n    - r1\n    - r2\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.csl"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := New("0.1.0", "file")
+	config, _ := structpb.NewStruct(map[string]any{"directory": tmpDir})
+	if _, err := svc.Init(context.Background(), &providerv1.InitRequest{Alias: "test", Config: config}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	type database struct {
+		Host     string   `json:"host"`
+		Port     string   `json:"port"`
+		Replicas []string `json:"replicas"`
+	}
+
+	got, err := FetchInto[database](svc, context.Background(), []string{"config", "database"})
+	if err != nil {
+		t.Fatalf("FetchInto failed: %v", err)
+	}
+	want := database{Host: "db.local", Port: "5432", Replicas: []string{"r1", "r2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Scalars are strings, so a numeric field is a type mismatch
+	type typedDatabase struct {
+		Port int `json:"port"`
+	}
+	_, err = FetchInto[typedDatabase](svc, context.Background(), []string{"config", "database"})
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field != "port" {
+		t.Errorf("Expected a wrapped UnmarshalTypeError for port, got %v", err)
+	}
+
+	_, err = FetchInto[database](svc, context.Background(), []string{"config", "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected the fetch error to pass through, got %v", err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := ValidateConfig(map[string]any{"directory": "./configs", "recursive": true}); err != nil {
+		t.Errorf("Expected a valid config to pass, got %v", err)
+	}
+	if err := ValidateConfig(map[string]any{"directroy": "./configs"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown key, got %v", err)
+	}
+}